@@ -0,0 +1,165 @@
+package fileops
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic makes a backup of filename if it exists according
+// to the backup policy of o (see Ops.Backup) and atomically
+// replaces it with content from r, validated by the validator of o
+// (if any), see replaceFileAtomic. Returns error on failure.
+func (o *Ops) writeFileAtomic(filename string, r io.Reader, perm os.FileMode, forcePerm bool) error {
+	_, err := o.writeFileAtomicFunc(filename, perm, forcePerm, copyFrom(r))
+	return err
+}
+
+// writeFileAtomicFunc is writeFileAtomic with the content written by
+// write, which may return false to leave filename untouched (e.g if
+// the content turned out to be unchanged). The backup is only made if
+// filename is about to be replaced. If o holds a lock on filename, the
+// new file is locked as well. Returns whether filename was replaced
+// or error on failure.
+func (o *Ops) writeFileAtomicFunc(filename string, perm os.FileMode, forcePerm bool, write func(w io.Writer) (bool, error)) (bool, error) {
+	return replaceFileAtomicFunc(filename, perm, forcePerm, func(tmp *os.File) (bool, error) {
+		replace, err := write(tmp)
+		if replace && err == nil && o.lock != nil {
+			err = o.lock.keep(tmp)
+		}
+		return replace, err
+	}, func(path string) error {
+		if o.validate != nil {
+			if err := o.validate(path); err != nil {
+				return err
+			}
+		}
+		if err := o.touch(filename); err != nil {
+			return err
+		}
+		if _, err := os.Stat(filename); err == nil {
+			if _, err := o.backupFile(filename); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// copyFrom returns a write function for writeFileAtomicFunc copying
+// everything from r.
+func copyFrom(r io.Reader) func(w io.Writer) (bool, error) {
+	return func(w io.Writer) (bool, error) {
+		_, err := io.Copy(w, r)
+		return true, err
+	}
+}
+
+// replaceFileAtomic writes everything from r into a temporary file in
+// the same directory as filename, syncs it to disk and renames it
+// over filename before syncing the directory. If filename already
+// exists, owner, group and extended attributes are carried over to
+// the new file as well as the mode unless forcePerm is true, in which
+// case perm is always used. If filename does not exist, the new file
+// is created with mode perm. Unless validate is nil, it is called
+// with the path of the complete temporary file before the rename and
+// an error aborts the replacement. A failure at any point leaves
+// filename untouched. Returns error on failure.
+func replaceFileAtomic(filename string, r io.Reader, perm os.FileMode, forcePerm bool, validate func(path string) error) error {
+	_, err := replaceFileAtomicFunc(filename, perm, forcePerm, func(tmp *os.File) (bool, error) {
+		return copyFrom(r)(tmp)
+	}, validate)
+	return err
+}
+
+// replaceFileAtomicFunc is replaceFileAtomic with the content of the
+// temporary file written by write. If write returns false, the
+// temporary file is removed and filename is left untouched. Returns
+// whether filename was replaced or error on failure.
+func replaceFileAtomicFunc(filename string, perm os.FileMode, forcePerm bool, write func(tmp *os.File) (bool, error), validate func(path string) error) (bool, error) {
+	// Replace the file a symlink points to, not the symlink itself
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = resolved
+	}
+	dir := filepath.Dir(filename)
+
+	existing, err := os.Stat(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if existing != nil && !existing.Mode().IsRegular() {
+		return false, fmt.Errorf("%s is not a regular file", filename)
+	}
+
+	mode := perm
+	if existing != nil && !forcePerm {
+		mode = modeBits(existing.Mode())
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	replace, err := write(tmp)
+	if err != nil {
+		return false, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if !replace {
+		return false, nil
+	}
+	if existing != nil {
+		if err := copyAttributes(filename, existing, tmp); err != nil {
+			return false, fmt.Errorf("failed to preserve attributes of %s: %w", filename, err)
+		}
+	}
+	// Chmod after chown as chown may clear setuid/setgid bits.
+	if err := tmp.Chmod(mode); err != nil {
+		return false, fmt.Errorf("failed to set mode on temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return false, fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if validate != nil {
+		if err := validate(tmpName); err != nil {
+			return false, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return false, fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+	committed = true
+
+	return true, syncDir(dir)
+}
+
+// modeBits returns the permission bits of mode along with the setuid,
+// setgid and sticky bits, i.e everything chmod can set.
+func modeBits(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// syncDir fsyncs directory dir in order to persist a rename.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+//go:build linux
+
+package fileops
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// copyAttributes copies owner, group and extended attributes (such
+// as SELinux labels and POSIX ACLs) from existing file src described
+// by info to file dst.
+func copyAttributes(src string, info os.FileInfo, dst *os.File) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := dst.Chown(int(st.Uid), int(st.Gid)); err != nil {
+			return err
+		}
+	}
+	return copyXattrs(src, dst.Name())
+}
+
+// copyXattrs copies all extended attributes from src to dst. Missing
+// xattr support in the underlying filesystem is not an error.
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil
+		}
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(src, buf)
+	if err != nil {
+		return err
+	}
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		vsize, err := syscall.Getxattr(src, attr, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, vsize)
+		vsize, err = syscall.Getxattr(src, attr, value)
+		if err != nil {
+			return err
+		}
+		if err := syscall.Setxattr(dst, attr, value[:vsize], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package fileops
+
+import "os"
+
+// copyAttributes is a no-op on platforms without support for
+// preserving owner, group and extended attributes.
+func copyAttributes(src string, info os.FileInfo, dst *os.File) error {
+	return nil
+}
@@ -0,0 +1,96 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	o := &Ops{}
+	dir := t.TempDir()
+	textfile := filepath.Join(dir, "config")
+
+	if err := o.writeFileAtomic(textfile, strings.NewReader("first\n"), 0600, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(textfile, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mode of existing file is preserved unless forcePerm is true
+	if err := o.writeFileAtomic(textfile, strings.NewReader("second\n"), 0644, false); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := os.FileMode(0640), info.Mode().Perm(); expected != got {
+		t.Errorf("Expected mode %v, got %v", expected, got)
+	}
+	content, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "second\n", string(content); expected != got {
+		t.Errorf("Expected content %q, got %q", expected, got)
+	}
+
+	if err := o.writeFileAtomic(textfile, strings.NewReader("third\n"), 0600, true); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := os.FileMode(0600), info.Mode().Perm(); expected != got {
+		t.Errorf("Expected mode %v, got %v", expected, got)
+	}
+
+	// No temporary files should be left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 file in %s, got %d", dir, len(entries))
+	}
+}
+
+func TestWriteFileAtomicSpecialBits(t *testing.T) {
+	o := &Ops{Backup: BackupNumbered}
+	textfile := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(textfile, []byte("first\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	special := os.FileMode(0755) | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if err := os.Chmod(textfile, special); err != nil {
+		t.Fatal(err)
+	}
+	checkMode := func(path string) {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := special, modeBits(info.Mode()); expected != got {
+			t.Errorf("Expected mode %v of %s, got %v", expected, path, got)
+		}
+	}
+
+	if _, err := o.EnsureLineInFileWithOptions(textfile, "second", LineOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(textfile)
+	checkMode(textfile + ".~1~")
+
+	if err := os.Chmod(textfile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.RestoreBackup(textfile); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(textfile)
+}
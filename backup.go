@@ -0,0 +1,282 @@
+package fileops
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupPolicy decides if and how a backup copy of an existing file
+// is made before it is modified.
+type BackupPolicy int
+
+const (
+	// BackupNone does not make any backups (the default).
+	BackupNone BackupPolicy = iota
+	// BackupNumbered makes numbered backups, e.g file.~1~, file.~2~,
+	// similar to install --backup=numbered.
+	BackupNumbered
+	// BackupTimestamped makes backups suffixed with a UTC timestamp,
+	// e.g file.20241231T235959.000000000Z~.
+	BackupTimestamped
+)
+
+// Format of the suffix of timestamped backups, sorts lexically.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// Package wide variable instructing functions modifying an existing
+// file to make a backup copy of it first, see BackupPolicy.
+var Backup BackupPolicy = BackupNone
+
+// Package wide variable for where to put backups. If empty, backups
+// are put next to the original file. If set, the absolute path of the
+// original file is mirrored under BackupDir, e.g /etc/ssh/sshd_config
+// is backed up as BackupDir/etc/ssh/sshd_config.~1~.
+var BackupDir string = ""
+
+// Package wide variable setting how many backups to keep per file,
+// the oldest are removed first. 0 keeps all backups.
+var BackupRetention int = 0
+
+// SetBackup can be used to set package-wide backup policy and
+// retention (number of backups to keep per file, 0 keeps all). If
+// optional backupDir is specified, the first item is used as
+// BackupDir.
+func SetBackup(policy BackupPolicy, retention int, backupDir ...string) {
+	Backup = policy
+	BackupRetention = retention
+	if len(backupDir) > 0 {
+		BackupDir = backupDir[0]
+	}
+}
+
+// Backups returns paths to all backups of path, oldest first.
+// Returns error on failure.
+func Backups(path string) ([]string, error) {
+	return std().Backups(path)
+}
+
+// Backups is Backups using the settings of o.
+func (o *Ops) Backups(path string) ([]string, error) {
+	target, err := o.resolve(path)
+	if err != nil {
+		return nil, o.orExit(err)
+	}
+	backups, err := o.listBackups(target)
+	if err != nil {
+		return nil, o.orExit(err)
+	}
+	paths := make([]string, len(backups))
+	for i := range backups {
+		paths[i] = backups[i].path
+	}
+	return paths, nil
+}
+
+// RestoreBackup atomically replaces path with the most recent backup
+// of it, see Backups. Restoring does not make a backup of its own.
+// Returns error if there is no backup or if something failed.
+func RestoreBackup(path string) error {
+	return std().RestoreBackup(path)
+}
+
+// RestoreBackup is RestoreBackup using the settings of o.
+func (o *Ops) RestoreBackup(path string) error {
+	backups, err := o.Backups(path)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return o.orExit(fmt.Errorf("no backup found for %s", path))
+	}
+	latest := backups[len(backups)-1]
+	if o.DryRun {
+		o.report(Event{Kind: EventFileWritten, Path: path, Action: ActionUpdated, Message: fmt.Sprintf("RestoreBackup(%q) <- %q", path, latest)})
+		return nil
+	}
+	src, err := os.Open(latest)
+	if err != nil {
+		return o.orExit(err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return o.orExit(err)
+	}
+	target, err := o.resolve(path)
+	if err != nil {
+		return o.orExit(err)
+	}
+	if err := o.touch(target); err != nil {
+		return o.orExit(err)
+	}
+	return o.orExit(replaceFileAtomic(target, src, modeBits(info.Mode()), true, nil))
+}
+
+// backupEntry describes a backup found by listBackups. number is 0
+// for timestamped backups.
+type backupEntry struct {
+	path    string
+	number  int
+	stamp   time.Time
+	modTime time.Time
+}
+
+// listBackups returns all numbered and timestamped backups of path,
+// oldest first.
+func (o *Ops) listBackups(path string) ([]backupEntry, error) {
+	dir, err := o.backupLocation(path)
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(path) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var backups []backupEntry
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, "~") {
+			continue
+		}
+		b := backupEntry{path: filepath.Join(dir, name)}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, prefix), "~")
+		if n, ok := strings.CutPrefix(suffix, "~"); ok {
+			if b.number, err = strconv.Atoi(n); err != nil || b.number < 1 {
+				continue
+			}
+		} else if b.stamp, err = time.Parse(backupTimeFormat, suffix); err != nil {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			b.modTime = info.ModTime()
+		}
+		backups = append(backups, b)
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		a, b := backups[i], backups[j]
+		switch {
+		case a.number > 0 && b.number > 0:
+			return a.number < b.number
+		case a.number == 0 && b.number == 0:
+			return a.stamp.Before(b.stamp)
+		}
+		return a.modTime.Before(b.modTime)
+	})
+	return backups, nil
+}
+
+// backupFile makes a backup of existing file path according to the
+// backup policy of o and removes backups exceeding
+// BackupRetention. Returns the path to the backup or an empty string
+// if no backup was made.
+func (o *Ops) backupFile(path string) (string, error) {
+	if o.Backup == BackupNone {
+		return "", nil
+	}
+	dir, err := o.backupLocation(path)
+	if err != nil {
+		return "", err
+	}
+	existing, err := o.listBackups(path)
+	if err != nil {
+		return "", err
+	}
+
+	var suffix string
+	switch o.Backup {
+	case BackupNumbered:
+		n := 1
+		for _, b := range existing {
+			if b.number >= n {
+				n = b.number + 1
+			}
+		}
+		suffix = fmt.Sprintf(".~%d~", n)
+	case BackupTimestamped:
+		suffix = "." + time.Now().UTC().Format(backupTimeFormat) + "~"
+	default:
+		return "", fmt.Errorf("unknown backup policy %d", o.Backup)
+	}
+	backupPath := filepath.Join(dir, filepath.Base(path)+suffix)
+
+	o.report(Event{Kind: EventBackup, Path: path, Message: fmt.Sprintf("backup %q -> %q", path, backupPath)})
+	if o.DryRun {
+		return backupPath, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := copyFileWithAttributes(path, backupPath); err != nil {
+		return "", fmt.Errorf("failed to backup %s: %w", path, err)
+	}
+
+	if o.BackupRetention > 0 {
+		for i := 0; i < len(existing)+1-o.BackupRetention; i++ {
+			if err := os.Remove(existing[i].path); err != nil && !os.IsNotExist(err) {
+				return backupPath, fmt.Errorf("failed to remove old backup: %w", err)
+			}
+		}
+	}
+	return backupPath, nil
+}
+
+// backupLocation returns the directory where backups of path are
+// kept, see Ops.BackupDir.
+func (o *Ops) backupLocation(path string) (string, error) {
+	if o.BackupDir == "" {
+		return filepath.Dir(path), nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(o.BackupDir, filepath.Dir(abs)), nil
+}
+
+// copyFileWithAttributes copies regular file src to new file dst
+// keeping mode, owner, group and extended attributes. The copy is
+// never readable by anyone not allowed to read src.
+func copyFileWithAttributes(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := copyAttributes(src, info, out); err == nil {
+		err = out.Chmod(modeBits(info.Mode()))
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
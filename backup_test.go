@@ -0,0 +1,60 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	defer SetBackup(BackupNone, 0, "")
+	SetBackup(BackupNumbered, 2)
+
+	dir := t.TempDir()
+	textfile := filepath.Join(dir, "config")
+
+	for _, content := range []string{"one", "two", "three", "four"} {
+		if err := PutFile(textfile, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := Backups(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{textfile + ".~2~", textfile + ".~3~"}
+	if len(backups) != len(expected) {
+		t.Fatalf("Expected backups %q, got %q", expected, backups)
+	}
+	for i := range expected {
+		if backups[i] != expected[i] {
+			t.Errorf("Expected backup %q, got %q", expected[i], backups[i])
+		}
+	}
+
+	if err := RestoreBackup(textfile); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "three\n", string(content); expected != got {
+		t.Errorf("Expected restored content %q, got %q", expected, got)
+	}
+
+	// Timestamped backups into a backup directory mirror the path
+	backupDir := t.TempDir()
+	SetBackup(BackupTimestamped, 0, backupDir)
+	if err := EnsureLineInFile(textfile, "five", nil, nil, true, false); err != nil {
+		t.Fatal(err)
+	}
+	backups, err = Backups(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || filepath.Dir(backups[0]) != filepath.Join(backupDir, dir) {
+		t.Errorf("Expected one backup in %s, got %q", filepath.Join(backupDir, dir), backups)
+	}
+}
@@ -0,0 +1,266 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BlockOptions configures EnsureBlockInFile and RemoveBlockFromFile.
+// Before, After, AnchorMatch and KeepSpaces of the embedded
+// LineOptions position a new block like EnsureLineInFileWithOptions
+// positions a line, FileMode, Owner, Group, Backup and Create apply
+// to the file. Other LineOptions are ignored.
+type BlockOptions struct {
+	LineOptions
+	// CommentStart and CommentEnd surround the marker lines,
+	// CommentStart is "#" if empty. For example, CommentStart "<!--"
+	// and CommentEnd "-->" gives marker lines like
+	// "<!-- BEGIN marker -->".
+	CommentStart, CommentEnd string
+}
+
+// markers returns the begin and end marker lines for marker.
+func (opts BlockOptions) markers(marker string) (begin, end string) {
+	start := opts.CommentStart
+	if start == "" {
+		start = "#"
+	}
+	suffix := ""
+	if opts.CommentEnd != "" {
+		suffix = " " + opts.CommentEnd
+	}
+	return start + " BEGIN " + marker + suffix, start + " END " + marker + suffix
+}
+
+// EnsureBlockInFile ensures the (multi-line) block is in textfile
+// between the marker lines "# BEGIN <marker>" and "# END <marker>".
+// If the markers already exist, the lines between them are replaced
+// by block in place. Otherwise block and markers are inserted after
+// the first line matching opts.After and/or before the first line
+// matching opts.Before, or appended if there are no anchors or none
+// of them match. See BlockOptions for the comment style and other
+// options. Returns a Result describing the change or error on
+// failure, e.g if only one of the markers exists.
+func EnsureBlockInFile(textfile, marker, block string, opts BlockOptions) (Result, error) {
+	return std().EnsureBlockInFile(textfile, marker, block, opts)
+}
+
+// EnsureBlockInFile is EnsureBlockInFile using the settings of o.
+func (o *Ops) EnsureBlockInFile(textfile, marker, block string, opts BlockOptions) (Result, error) {
+	o.reportCall("EnsureBlockInFile(%q, %q, %q, %+v)", textfile, marker, block, opts)
+	_, before, after, err := opts.matchers("")
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
+	}
+	return o.editLines(textfile, opts.LineOptions, newBlockEnsurer(marker, block, before, after, opts))
+}
+
+// EnsureBlockInLines ensures block is in lines string pointer slice
+// like EnsureBlockInFile. Returns error on failure.
+func EnsureBlockInLines(lines *[]string, marker, block string, opts BlockOptions) error {
+	return std().EnsureBlockInLines(lines, marker, block, opts)
+}
+
+// EnsureBlockInLines is EnsureBlockInLines using the settings of o.
+func (o *Ops) EnsureBlockInLines(lines *[]string, marker, block string, opts BlockOptions) error {
+	if lines == nil {
+		return o.orExit(errors.New("nil pointer"))
+	}
+	_, before, after, err := opts.matchers("")
+	if err != nil {
+		return o.orExit(err)
+	}
+	edited, _, err := editSlice(newBlockEnsurer(marker, block, before, after, opts), *lines)
+	if err != nil {
+		return o.orExit(err)
+	}
+	*lines = edited
+	return nil
+}
+
+// RemoveBlockFromFile removes the block between (and including) the
+// marker lines "# BEGIN <marker>" and "# END <marker>" from textfile,
+// see EnsureBlockInFile. Returns a Result describing the change or
+// error on failure.
+func RemoveBlockFromFile(textfile, marker string, opts BlockOptions) (Result, error) {
+	return std().RemoveBlockFromFile(textfile, marker, opts)
+}
+
+// RemoveBlockFromFile is RemoveBlockFromFile using the settings of o.
+func (o *Ops) RemoveBlockFromFile(textfile, marker string, opts BlockOptions) (Result, error) {
+	o.reportCall("RemoveBlockFromFile(%q, %q, %+v)", textfile, marker, opts)
+	return o.editLines(textfile, opts.LineOptions, &blockRemover{blockFinder: newBlockFinder(marker, opts)})
+}
+
+// RemoveBlockFromLines removes the block marked by marker from lines
+// string pointer slice like RemoveBlockFromFile. Returns error on
+// failure.
+func RemoveBlockFromLines(lines *[]string, marker string, opts BlockOptions) error {
+	return std().RemoveBlockFromLines(lines, marker, opts)
+}
+
+// RemoveBlockFromLines is RemoveBlockFromLines using the settings of o.
+func (o *Ops) RemoveBlockFromLines(lines *[]string, marker string, opts BlockOptions) error {
+	if lines == nil {
+		return o.orExit(errors.New("nil pointer"))
+	}
+	edited, _, err := editSlice(&blockRemover{blockFinder: newBlockFinder(marker, opts)}, *lines)
+	if err != nil {
+		return o.orExit(err)
+	}
+	*lines = edited
+	return nil
+}
+
+// blockEnsurer is a lineEditor replacing the lines between the
+// markers of a block with the block, or inserting the block
+// surrounded by markers according to the before and after anchors if
+// the markers are missing.
+type blockEnsurer struct {
+	blockFinder
+	// lines are the lines of the block including markers
+	lines         []string
+	before, after anchor
+	// i is the index of the line being edited
+	i int
+	// insertBefore and insertAfter are the indices of the lines to
+	// insert a missing block before or after, both -1 to append it
+	insertBefore, insertAfter int
+}
+
+// newBlockEnsurer returns a blockEnsurer for block marked by marker.
+func newBlockEnsurer(marker, block string, before, after matcher, opts BlockOptions) *blockEnsurer {
+	beginMarker, endMarker := opts.markers(marker)
+	lines := []string{beginMarker}
+	if block != "" {
+		lines = append(lines, strings.Split(strings.TrimSuffix(block, "\n"), "\n")...)
+	}
+	return &blockEnsurer{
+		blockFinder:  newBlockFinder(marker, opts),
+		lines:        append(lines, endMarker),
+		before:       anchor{match: before},
+		after:        anchor{match: after},
+		insertBefore: -1,
+		insertAfter:  -1,
+	}
+}
+
+func (e *blockEnsurer) scan(line string) {
+	e.before.scan(e.n, line)
+	e.after.scan(e.n, line)
+	e.blockFinder.scan(line)
+}
+
+func (e *blockEnsurer) prepare() (Action, error) {
+	if err := e.found(); err != nil {
+		return ActionNone, err
+	}
+	if e.beginIndex != -1 {
+		return ActionReplaced, nil
+	}
+	e.insertBefore, e.insertAfter = insertion(&e.before, &e.after, -1)
+	return ActionInserted, nil
+}
+
+func (e *blockEnsurer) edit(line string, emit func(line string)) {
+	i := e.i
+	e.i++
+	switch {
+	case i == e.beginIndex || i == e.insertBefore:
+		e.emitBlock(emit)
+	case i > e.beginIndex && i <= e.endIndex:
+	default:
+		emit(line)
+	}
+	switch {
+	case i == e.insertBefore:
+		emit(line)
+	case i == e.insertAfter:
+		e.emitBlock(emit)
+	}
+}
+
+func (e *blockEnsurer) end(emit func(line string)) {
+	if e.beginIndex == -1 && e.insertBefore == -1 && e.insertAfter == -1 {
+		e.emitBlock(emit)
+	}
+}
+
+func (e *blockEnsurer) emitBlock(emit func(line string)) {
+	for _, line := range e.lines {
+		emit(line)
+	}
+}
+
+// blockRemover is a lineEditor removing a block including its
+// markers.
+type blockRemover struct {
+	blockFinder
+	// i is the index of the line being edited
+	i int
+}
+
+func (r *blockRemover) prepare() (Action, error) {
+	if err := r.found(); err != nil || r.beginIndex == -1 {
+		return ActionNone, err
+	}
+	return ActionRemoved, nil
+}
+
+func (r *blockRemover) edit(line string, emit func(line string)) {
+	if r.i < r.beginIndex || r.i > r.endIndex {
+		emit(line)
+	}
+	r.i++
+}
+
+func (r *blockRemover) end(func(line string)) {}
+
+// blockFinder locates the begin and end marker lines of a block while
+// scanning lines.
+type blockFinder struct {
+	marker                 string
+	beginMarker, endMarker string
+	// n is the number of lines scanned
+	n int
+	// beginIndex and endIndex are the indices of the marker lines or
+	// -1
+	beginIndex, endIndex int
+	// anyEnd is true if an end marker exists anywhere
+	anyEnd bool
+}
+
+// newBlockFinder returns a blockFinder for the block marked by marker.
+func newBlockFinder(marker string, opts BlockOptions) blockFinder {
+	beginMarker, endMarker := opts.markers(marker)
+	return blockFinder{marker: marker, beginMarker: beginMarker, endMarker: endMarker, beginIndex: -1, endIndex: -1}
+}
+
+func (f *blockFinder) scan(line string) {
+	line = strings.TrimSpace(line)
+	if f.beginIndex == -1 && line == f.beginMarker {
+		f.beginIndex = f.n
+	}
+	if line == f.endMarker {
+		f.anyEnd = true
+		if f.beginIndex != -1 && f.endIndex == -1 {
+			f.endIndex = f.n
+		}
+	}
+	f.n++
+}
+
+// found returns error if only one of the markers has been found or if
+// they are out of order. Otherwise, beginIndex and endIndex are -1 if
+// there is no such block.
+func (f *blockFinder) found() error {
+	if f.beginIndex == -1 && !f.anyEnd {
+		return nil
+	}
+	if f.beginIndex == -1 || f.endIndex == -1 {
+		f.beginIndex, f.endIndex = -1, -1
+		return fmt.Errorf("incomplete block %q: %q and %q must both exist in order", f.marker, f.beginMarker, f.endMarker)
+	}
+	return nil
+}
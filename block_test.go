@@ -0,0 +1,48 @@
+package fileops
+
+import (
+	"testing"
+)
+
+func TestBlockInFile(t *testing.T) {
+	o := &Ops{}
+	hosts := []string{"127.0.0.1 localhost", "::1 localhost"}
+	withBlock := []string{"127.0.0.1 localhost", "# BEGIN cluster", "10.0.0.1 node1", "10.0.0.2 node2", "# END cluster", "::1 localhost"}
+	testLineEdits(t, []lineEditTest{
+		{"insert", hosts, func(textfile string) (Result, error) {
+			return o.EnsureBlockInFile(textfile, "cluster", "10.0.0.1 node1\n10.0.0.2 node2\n", BlockOptions{LineOptions: LineOptions{After: "127.0.0.1"}})
+		}, ActionInserted, withBlock},
+		{"unchanged", withBlock, func(textfile string) (Result, error) {
+			return o.EnsureBlockInFile(textfile, "cluster", "10.0.0.1 node1\n10.0.0.2 node2", BlockOptions{})
+		}, ActionNone, withBlock},
+		{"update in place", withBlock, func(textfile string) (Result, error) {
+			return o.EnsureBlockInFile(textfile, "cluster", "10.0.0.3 node3", BlockOptions{})
+		}, ActionReplaced, []string{"127.0.0.1 localhost", "# BEGIN cluster", "10.0.0.3 node3", "# END cluster", "::1 localhost"}},
+		{"comment style", hosts, func(textfile string) (Result, error) {
+			return o.EnsureBlockInFile(textfile, "other", "x", BlockOptions{CommentStart: "<!--", CommentEnd: "-->"})
+		}, ActionInserted, []string{"127.0.0.1 localhost", "::1 localhost", "<!-- BEGIN other -->", "x", "<!-- END other -->"}},
+		{"remove", withBlock, func(textfile string) (Result, error) {
+			return o.RemoveBlockFromFile(textfile, "cluster", BlockOptions{})
+		}, ActionRemoved, hosts},
+		{"remove none", hosts, func(textfile string) (Result, error) {
+			return o.RemoveBlockFromFile(textfile, "cluster", BlockOptions{})
+		}, ActionNone, hosts},
+	})
+}
+
+func TestBlockInLinesIncomplete(t *testing.T) {
+	o := &Ops{}
+	lines := []string{"a", "# BEGIN m", "b"}
+	if err := o.EnsureBlockInLines(&lines, "m", "c", BlockOptions{}); err == nil {
+		t.Error("Expected error for missing end marker")
+	}
+	lines = []string{"# END m", "# BEGIN m"}
+	if err := o.RemoveBlockFromLines(&lines, "m", BlockOptions{}); err == nil {
+		t.Error("Expected error for markers out of order")
+	}
+	lines = []string{"a", "b"}
+	if err := o.EnsureBlockInLines(&lines, "m", "c", BlockOptions{LineOptions: LineOptions{Before: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, []string{"a", "# BEGIN m", "c", "# END m", "b"})
+}
@@ -0,0 +1,141 @@
+package fileops
+
+import (
+	"errors"
+	"strings"
+)
+
+// CommentLineInFile comments out lines matching line in textfile by
+// prefixing them with opts.Comment ("#" by default), at most
+// opts.Count lines (or all of them if 0). Lines already commented out
+// are left untouched. See LineOptions for how lines are matched and
+// other options, opts.Before and opts.After are not used. Returns a
+// Result describing the change or error on failure.
+func CommentLineInFile(textfile, line string, opts LineOptions) (Result, error) {
+	return std().CommentLineInFile(textfile, line, opts)
+}
+
+// CommentLineInFile is CommentLineInFile using the settings of o.
+func (o *Ops) CommentLineInFile(textfile, line string, opts LineOptions) (Result, error) {
+	o.reportCall("CommentLineInFile(%q, %q, %+v)", textfile, line, opts)
+	ed, err := newLineCommenter(line, false, opts)
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
+	}
+	return o.editLines(textfile, opts, ed)
+}
+
+// CommentLineInLines comments out lines matching line in lines string
+// pointer slice like CommentLineInFile. Returns error on failure.
+func CommentLineInLines(lines *[]string, line string, opts LineOptions) error {
+	return std().CommentLineInLines(lines, line, opts)
+}
+
+// CommentLineInLines is CommentLineInLines using the settings of o.
+func (o *Ops) CommentLineInLines(lines *[]string, line string, opts LineOptions) error {
+	return o.commentLineInLines(lines, line, false, opts)
+}
+
+// UncommentLineInFile uncomments lines in textfile commented out with
+// opts.Comment ("#" by default) that match line once uncommented, at
+// most opts.Count lines (or all of them if 0). The comment prefix and
+// any spaces following it are removed, e.g "# PermitRootLogin no"
+// becomes "PermitRootLogin no". See LineOptions for how lines are
+// matched and other options, opts.Before and opts.After are not used.
+// Returns a Result describing the change or error on failure.
+func UncommentLineInFile(textfile, line string, opts LineOptions) (Result, error) {
+	return std().UncommentLineInFile(textfile, line, opts)
+}
+
+// UncommentLineInFile is UncommentLineInFile using the settings of o.
+func (o *Ops) UncommentLineInFile(textfile, line string, opts LineOptions) (Result, error) {
+	o.reportCall("UncommentLineInFile(%q, %q, %+v)", textfile, line, opts)
+	ed, err := newLineCommenter(line, true, opts)
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
+	}
+	return o.editLines(textfile, opts, ed)
+}
+
+// UncommentLineInLines uncomments lines matching line in lines string
+// pointer slice like UncommentLineInFile. Returns error on failure.
+func UncommentLineInLines(lines *[]string, line string, opts LineOptions) error {
+	return std().UncommentLineInLines(lines, line, opts)
+}
+
+// UncommentLineInLines is UncommentLineInLines using the settings of o.
+func (o *Ops) UncommentLineInLines(lines *[]string, line string, opts LineOptions) error {
+	return o.commentLineInLines(lines, line, true, opts)
+}
+
+// commentLineInLines implements CommentLineInLines and
+// UncommentLineInLines.
+func (o *Ops) commentLineInLines(lines *[]string, line string, uncomment bool, opts LineOptions) error {
+	if lines == nil {
+		return o.orExit(errors.New("nil pointer"))
+	}
+	ed, err := newLineCommenter(line, uncomment, opts)
+	if err != nil {
+		return o.orExit(err)
+	}
+	*lines, _, _ = editSlice(ed, *lines)
+	return nil
+}
+
+// lineCommenter is a lineEditor commenting out the first n lines (or
+// all of them if n is -1) matching match, or uncommenting the first n
+// commented-out lines matching match once uncommented.
+type lineCommenter struct {
+	match       matcher
+	comment     string
+	uncomment   bool
+	n           int
+	transformed int
+}
+
+// newLineCommenter returns a lineCommenter for lines matching line
+// according to opts. Returns error if line is an invalid regular
+// expression.
+func newLineCommenter(line string, uncomment bool, opts LineOptions) (*lineCommenter, error) {
+	match, err := newMatcher(line, opts.Match, opts.KeepSpaces)
+	if err != nil {
+		return nil, err
+	}
+	return &lineCommenter{match: match, comment: opts.comment(), uncomment: uncomment, n: opts.count()}, nil
+}
+
+func (c *lineCommenter) scan(string) {}
+
+func (c *lineCommenter) prepare() (Action, error) {
+	return ActionReplaced, nil
+}
+
+func (c *lineCommenter) edit(line string, emit func(line string)) {
+	if c.n == -1 || c.transformed < c.n {
+		text, commented := uncomment(line, c.comment)
+		switch {
+		case c.uncomment && commented && c.match(text):
+			line = text
+			c.transformed++
+		case !c.uncomment && !commented && c.match(line):
+			line = c.comment + line
+			c.transformed++
+		}
+	}
+	emit(line)
+}
+
+func (c *lineCommenter) end(func(line string)) {}
+
+// uncomment returns line without comment prefix and the spaces
+// following it, keeping any indentation before the prefix, and true
+// if line is commented out. Otherwise line is returned as is with
+// false.
+func uncomment(line, prefix string) (string, bool) {
+	text := strings.TrimLeft(line, " \t")
+	rest, ok := strings.CutPrefix(text, prefix)
+	if !ok {
+		return line, false
+	}
+	return line[:len(line)-len(text)] + strings.TrimLeft(rest, " \t"), true
+}
@@ -0,0 +1,60 @@
+package fileops
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCommentLines(t *testing.T) {
+	o := &Ops{}
+	config := []string{"#Port 22", "# PermitRootLogin yes", "PasswordAuthentication yes", "UsePAM yes"}
+	testLineEdits(t, []lineEditTest{
+		{"uncomment", config, func(textfile string) (Result, error) {
+			return o.UncommentLineInFile(textfile, "Port ", LineOptions{})
+		}, ActionReplaced, []string{"Port 22", "# PermitRootLogin yes", "PasswordAuthentication yes", "UsePAM yes"}},
+		{"uncomment none", config, func(textfile string) (Result, error) {
+			return o.UncommentLineInFile(textfile, "UsePAM", LineOptions{})
+		}, ActionNone, config},
+		{"comment", config, func(textfile string) (Result, error) {
+			return o.CommentLineInFile(textfile, "PasswordAuthentication", LineOptions{})
+		}, ActionReplaced, []string{"#Port 22", "# PermitRootLogin yes", "#PasswordAuthentication yes", "UsePAM yes"}},
+		{"comment none", config, func(textfile string) (Result, error) {
+			return o.CommentLineInFile(textfile, "Port", LineOptions{Match: MatchContains})
+		}, ActionNone, config},
+		{"replace commented", config, func(textfile string) (Result, error) {
+			return o.EnsureLineInFileWithOptions(textfile, "PermitRootLogin no", LineOptions{Existing: "PermitRootLogin ", ReplaceCommented: true})
+		}, ActionReplaced, []string{"#Port 22", "PermitRootLogin no", "PasswordAuthentication yes", "UsePAM yes"}},
+		{"replace uncommented", config, func(textfile string) (Result, error) {
+			return o.EnsureLineInFileWithOptions(textfile, "UsePAM no", LineOptions{Existing: "UsePAM ", ReplaceCommented: true})
+		}, ActionReplaced, []string{"#Port 22", "# PermitRootLogin yes", "PasswordAuthentication yes", "UsePAM no"}},
+		{"replace none", config, func(textfile string) (Result, error) {
+			return o.EnsureLineInFileWithOptions(textfile, "PasswordAuthentication yes", LineOptions{Existing: "PasswordAuthentication ", ReplaceCommented: true})
+		}, ActionNone, config},
+		{"append", config, func(textfile string) (Result, error) {
+			return o.EnsureLineInFileWithOptions(textfile, "X11Forwarding no", LineOptions{ReplaceCommented: true})
+		}, ActionInserted, append(slices.Clone(config), "X11Forwarding no")},
+	})
+}
+
+func TestCommentLinesInLines(t *testing.T) {
+	o := &Ops{}
+	lines := []string{"  // a = 1", "b = 2", "a = 3"}
+	if err := o.UncommentLineInLines(&lines, "a =", LineOptions{Comment: "//"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.CommentLineInLines(&lines, "a =", LineOptions{Comment: "//", Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, []string{"//  a = 1", "b = 2", "a = 3"})
+
+	// Settings are replaced where they are, not moved into a trailing
+	// Match block
+	lines = []string{"Port 22", "#PermitRootLogin yes", "Match User x", "  X11Forwarding no"}
+	for _, line := range []string{"Port 2222", "PermitRootLogin no"} {
+		if err := o.EnsureLineInLinesWithOptions(&lines, line, LineOptions{Existing: strings.Fields(line)[0] + " ", ReplaceCommented: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compareLines(t, &lines, []string{"Port 2222", "PermitRootLogin no", "Match User x", "  X11Forwarding no"})
+}
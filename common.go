@@ -5,7 +5,10 @@ package fileops
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"time"
 )
 
 // Package wide variable instructing functions whether to actually
@@ -31,9 +34,120 @@ func SetExitOnError(state bool) {
 	ExitOnError = state
 }
 
-func orExit(err error) error {
-	if ExitOnError && err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+// Ops carries the settings used by all operations in this package.
+// Unlike the package wide variables, an Ops is local to the caller,
+// so differently configured Ops can be used concurrently, e.g a
+// dry-run alongside a real run or from parallel tests. The zero value
+// is ready to use and behaves like the package defaults. All
+// top-level functions are available as methods on Ops, the top-level
+// functions use a default Ops configured from the package wide
+// variables (DryRun, ExitOnError, Backup, etc).
+type Ops struct {
+	// DryRun instructs methods not to write to files or run
+	// commands, see SetDryRun.
+	DryRun bool
+	// ExitOnError instructs methods to call os.Exit(1) on error
+	// instead of return err, see SetExitOnError.
+	ExitOnError bool
+	// Stdin, Stdout and Stderr are used by commands and prompts as
+	// well as for dry-run and progress output. Defaults to os.Stdin,
+	// os.Stdout and os.Stderr if nil.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Root, if not empty, is the directory under which every path
+	// given to the methods is resolved, like inside a chroot (e.g
+	// when provisioning a mounted image). Paths or symlinks can not
+	// escape Root. User and group lookups consult /etc/passwd and
+	// /etc/group under Root instead of the host's.
+	Root string
+	// Logger, if not nil, receives a record for the outcome of every
+	// operation as well as every error.
+	Logger *slog.Logger
+	// DiffContext is the number of unchanged lines shown around
+	// changes in diffs, 3 if 0, none if negative.
+	DiffContext int
+	// Reporter, if not nil, receives dry-run and progress output as
+	// events instead of it being written as text to Stderr, see
+	// TextReporter, JSONReporter and SilentReporter.
+	Reporter Reporter
+	// Backup, BackupDir and BackupRetention configure backups before
+	// modifying a file, see the package wide variables with the same
+	// names.
+	Backup          BackupPolicy
+	BackupDir       string
+	BackupRetention int
+	// LockTimeout is how long to wait for a file lock, forever if 0,
+	// see WithFileLock.
+	LockTimeout time.Duration
+
+	// tx, if not nil, is the Transaction o takes part in.
+	tx *Transaction
+	// validate, if not nil, validates files before they are
+	// replaced, see replaceFileAtomic.
+	validate func(path string) error
+	// lock, if not nil, is the lock held on the file being edited,
+	// kept on the file replacing it, see fileLock.
+	lock *fileLock
+	// held are the locks held through WithFileLock, by lockKey.
+	held map[string]*fileLock
+}
+
+// std returns the default Ops used by the top-level functions,
+// configured from the package wide variables.
+func std() *Ops {
+	return &Ops{
+		DryRun:          DryRun,
+		ExitOnError:     ExitOnError,
+		Backup:          Backup,
+		BackupDir:       BackupDir,
+		BackupRetention: BackupRetention,
+		LockTimeout:     LockTimeout,
+		Reporter:        DefaultReporter,
+	}
+}
+
+func (o *Ops) stdin() io.Reader {
+	if o.Stdin == nil {
+		return os.Stdin
+	}
+	return o.Stdin
+}
+
+func (o *Ops) stdout() io.Writer {
+	if o.Stdout == nil {
+		return os.Stdout
+	}
+	return o.Stdout
+}
+
+func (o *Ops) stderr() io.Writer {
+	if o.Stderr == nil {
+		return os.Stderr
+	}
+	return o.Stderr
+}
+
+// logResult passes result to Logger unless Logger is nil or err is
+// not nil (errors are logged by orExit).
+func (o *Ops) logResult(result Result, err error) {
+	if o.Logger == nil || err != nil {
+		return
+	}
+	o.Logger.Info(result.String(),
+		slog.Bool("changed", result.Changed),
+		slog.String("action", string(result.Action)),
+		slog.String("path", result.Path),
+		slog.String("command", result.Command),
+		slog.Bool("dryRun", o.DryRun))
+}
+
+func (o *Ops) orExit(err error) error {
+	if err != nil && o.Logger != nil {
+		o.Logger.Error(err.Error())
+	}
+	if o.ExitOnError && err != nil {
+		fmt.Fprintf(o.stderr(), "ERROR: %v\n", err)
 		os.Exit(1)
 	}
 	return err
@@ -0,0 +1,64 @@
+package fileops
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOpsConcurrentDryRun(t *testing.T) {
+	tests := []struct {
+		name            string
+		dryRun          bool
+		expectedContent string
+	}{
+		{"dry-run", true, "127.0.0.1 localhost\n"},
+		{"real", false, "127.0.0.1 localhost\n10.0.0.1 gateway\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			if err := PutFile(filepath.Join(root, "etc", "hosts"), "127.0.0.1 localhost", 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stderr bytes.Buffer
+			o := &Ops{DryRun: tt.dryRun, Stderr: &stderr, Root: root}
+			result, err := o.EnsureLineInFileWithResult("/etc/hosts", "10.0.0.1 gateway", nil, nil, true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Changed || result.Action != ActionInserted {
+				t.Errorf("Expected line to be inserted, got %s", result)
+			}
+			if tt.dryRun && !strings.Contains(stderr.String(), "+10.0.0.1 gateway") {
+				t.Errorf("Expected diff in dry-run output, got %q", stderr.String())
+			}
+
+			content, err := os.ReadFile(filepath.Join(root, "etc", "hosts"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.expectedContent {
+				t.Errorf("Expected content %q, got %q", tt.expectedContent, content)
+			}
+		})
+	}
+}
+
+func TestErrorLoggedOnce(t *testing.T) {
+	var log bytes.Buffer
+	o := &Ops{Logger: slog.New(slog.NewTextHandler(&log, nil))}
+	fsys := fstest.MapFS{"etc/app/sub/broken.tmpl": {Data: []byte("{{ .Missing }")}}
+	if _, err := o.PutTemplateFromFS(fsys, "etc/app", t.TempDir(), nil, TemplateOptions{}); err == nil {
+		t.Fatal("Expected parse error")
+	}
+	if n := strings.Count(log.String(), "level=ERROR"); n != 1 {
+		t.Errorf("Expected the error to be logged once, got %d times:\n%s", n, log.String())
+	}
+}
@@ -0,0 +1,202 @@
+package fileops
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+)
+
+// maxDiffSize is the size in bytes above which content is summarized
+// instead of diffed.
+const maxDiffSize = 1 << 20
+
+// binarySniffLen is the number of leading bytes searched for a NUL
+// byte when detecting binary content, same as git.
+const binarySniffLen = 8000
+
+// defaultDiffContext is the number of unchanged lines shown around
+// changes in diffs unless Ops.DiffContext says otherwise.
+const defaultDiffContext = 3
+
+// diffContext returns the number of context lines of diffs, see
+// Ops.DiffContext.
+func (o *Ops) diffContext() int {
+	switch {
+	case o.DiffContext == 0:
+		return defaultDiffContext
+	case o.DiffContext < 0:
+		return 0
+	}
+	return o.DiffContext
+}
+
+// unifiedDiff returns a unified diff between before and after
+// content of textfile or an empty string if there is no difference.
+func (o *Ops) unifiedDiff(textfile, before, after string) string {
+	return o.diffLabels(path.Join("a", textfile), path.Join("b", textfile), before, after)
+}
+
+// diffLabels returns a unified diff between before and after labelled
+// from and to or an empty string if there is no difference.
+func (o *Ops) diffLabels(from, to, before, after string) string {
+	edits := myers.ComputeEdits(span.URIFromPath(from), before, after)
+	return fmt.Sprint(toUnified(from, to, before, edits, o.diffContext()))
+}
+
+// toUnified is gotextdiff.ToUnified with context lines of unchanged
+// content around the edits instead of always 3. edits must be line
+// based as returned by myers.ComputeEdits.
+func toUnified(from, to, content string, edits []gotextdiff.TextEdit, context int) gotextdiff.Unified {
+	u := gotextdiff.Unified{From: from, To: to}
+	if len(edits) == 0 {
+		return u
+	}
+	lines := splitLines(content)
+	addEqualLines := func(h *gotextdiff.Hunk, start, end int) int {
+		delta := 0
+		for i := max(start, 0); i < min(end, len(lines)); i++ {
+			h.Lines = append(h.Lines, gotextdiff.Line{Kind: gotextdiff.Equal, Content: lines[i]})
+			delta++
+		}
+		return delta
+	}
+
+	var h *gotextdiff.Hunk
+	last, toLine := 0, 0
+	for _, edit := range edits {
+		start := edit.Span.Start().Line() - 1
+		end := edit.Span.End().Line() - 1
+		switch {
+		case h != nil && start == last:
+			// Direct extension of the previous edit
+		case h != nil && start <= last+2*context:
+			// Within range of the previous edit, add the lines between
+			addEqualLines(h, last, start)
+		default:
+			// Start a new hunk, adding the trailing context of the
+			// previous one
+			if h != nil {
+				addEqualLines(h, last, last+context)
+				u.Hunks = append(u.Hunks, h)
+			}
+			toLine += start - last
+			h = &gotextdiff.Hunk{FromLine: start + 1, ToLine: toLine + 1}
+			delta := addEqualLines(h, start-context, start)
+			h.FromLine -= delta
+			h.ToLine -= delta
+		}
+		last = start
+		for i := start; i < end; i++ {
+			h.Lines = append(h.Lines, gotextdiff.Line{Kind: gotextdiff.Delete, Content: lines[i]})
+			last++
+		}
+		if edit.NewText != "" {
+			for _, line := range splitLines(edit.NewText) {
+				h.Lines = append(h.Lines, gotextdiff.Line{Kind: gotextdiff.Insert, Content: line})
+				toLine++
+			}
+		}
+	}
+	addEqualLines(h, last, last+context)
+	u.Hunks = append(u.Hunks, h)
+	return u
+}
+
+// splitLines splits text into lines keeping the line endings.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// fileDiff returns a unified diff between the before and after
+// content of file name or an empty string if there is no difference.
+// If the file did not exist (existed is false), it is diffed against
+// /dev/null. Binary content or content larger than maxDiffSize is
+// summarized in a single line instead.
+func (o *Ops) fileDiff(name string, before, after []byte, existed bool) string {
+	if existed && bytes.Equal(before, after) {
+		return ""
+	}
+	from, to := diffNames(name, existed)
+	switch {
+	case isBinary(before) || isBinary(after):
+		return fmt.Sprintf("Binary files %s and %s differ\n", from, to)
+	case len(before) > maxDiffSize || len(after) > maxDiffSize:
+		return sizeSummary(from, to, int64(len(before)), int64(len(after)))
+	}
+	return o.diffLabels(from, to, string(before), string(after))
+}
+
+// lineDiff returns a unified diff between the content of textfile
+// before and after a line edit, or a summary if either is larger than
+// maxDiffSize.
+func (o *Ops) lineDiff(textfile string, before, after *diffBuffer) string {
+	if before.size > maxDiffSize || after.size > maxDiffSize {
+		from, to := diffNames(textfile, true)
+		return sizeSummary(from, to, before.size, after.size)
+	}
+	return o.unifiedDiff(textfile, before.buf.String(), after.buf.String())
+}
+
+// diffBuffer keeps the content written to it up to just over
+// maxDiffSize (enough to diff it unless it is too large) along with
+// the size and hash of all of it.
+type diffBuffer struct {
+	buf  bytes.Buffer
+	size int64
+	sum  hash.Hash
+}
+
+// newDiffBuffer returns an empty diffBuffer.
+func newDiffBuffer() *diffBuffer {
+	return &diffBuffer{sum: sha256.New()}
+}
+
+// Write implements io.Writer, never failing.
+func (b *diffBuffer) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	b.sum.Write(p)
+	if room := maxDiffSize + 1 - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// hash returns the hex encoded SHA-256 sum of everything written to
+// b, see hashContent.
+func (b *diffBuffer) hash() string {
+	return hex.EncodeToString(b.sum.Sum(nil))
+}
+
+// diffNames returns the from and to labels of a diff of file name,
+// from being /dev/null unless the file existed.
+func diffNames(name string, existed bool) (from, to string) {
+	from = path.Join("a", name)
+	if !existed {
+		from = "/dev/null"
+	}
+	return from, path.Join("b", name)
+}
+
+// sizeSummary summarizes a difference between files from and to too
+// large to be diffed.
+func sizeSummary(from, to string, beforeSize, afterSize int64) string {
+	return fmt.Sprintf("Files %s and %s differ (%d -> %d bytes)\n", from, to, beforeSize, afterSize)
+}
+
+// isBinary reports whether content looks binary, i.e has a NUL byte
+// within the first binarySniffLen bytes.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) != -1
+}
@@ -1,16 +1,8 @@
 package fileops
 
 import (
-	"bufio"
 	"errors"
-	"fmt"
 	"os"
-	"path"
-	"strings"
-
-	"github.com/hexops/gotextdiff"
-	"github.com/hexops/gotextdiff/myers"
-	"github.com/hexops/gotextdiff/span"
 )
 
 // EnsureLineInFile ensures line is in textfile, optionally before
@@ -22,153 +14,281 @@ import (
 // the first item in the slice is used as file mode if textfile does
 // not exist. Returns error on failure.
 func EnsureLineInFile(textfile, line string, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool, filePerm ...os.FileMode) error {
-	var fileMode os.FileMode = 0644
+	return std().EnsureLineInFile(textfile, line, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces, filePerm...)
+}
+
+// EnsureLineInFile is EnsureLineInFile using the settings of o.
+func (o *Ops) EnsureLineInFile(textfile, line string, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool, filePerm ...os.FileMode) error {
+	_, err := o.EnsureLineInFileWithResult(textfile, line, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces, filePerm...)
+	return err
+}
+
+// EnsureLineInFileWithResult is EnsureLineInFile returning a Result
+// describing whether line was inserted, moved, replaced or already in
+// place. Returns error on failure.
+func EnsureLineInFileWithResult(textfile, line string, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool, filePerm ...os.FileMode) (Result, error) {
+	return std().EnsureLineInFileWithResult(textfile, line, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces, filePerm...)
+}
+
+// EnsureLineInFileWithResult is EnsureLineInFileWithResult using the settings of o.
+func (o *Ops) EnsureLineInFileWithResult(textfile, line string, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool, filePerm ...os.FileMode) (Result, error) {
+	o.reportCall("EnsureLineInFile(%q, %q, %+v, %+v, %t, %t)", textfile, line, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	opts := flagOptions(before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	opts.Create = true
 	if len(filePerm) > 0 {
-		fileMode = filePerm[0]
+		opts.FileMode = filePerm[0]
 	}
+	return o.ensureLineInFile(textfile, line, opts)
+}
 
-	var f *os.File
-	var err error
-	if DryRun {
-		f, err = os.CreateTemp("", "dry-run-")
-		if err != nil {
-			return orExit(err)
-		}
-		defer os.Remove(f.Name())
-		defer f.Close()
-	} else {
-		f, err = os.OpenFile(textfile, os.O_RDWR|os.O_CREATE, fileMode)
-		if err != nil {
-			return orExit(err)
-		}
-		defer f.Close()
+// EnsureLineInLines ensures line is in lines string pointer slice,
+// optionally before and/or after string(s) unless before/after is/are
+// nil. Will trim leading and trailing spaces from line read from
+// lines before matching unless matchWithLeadingAndTrailingSpaces is
+// true. Will treat after and before as prefix unless
+// matchFullStringNotJustPrefix. Returns error on failure.
+func EnsureLineInLines(lines *[]string, line string, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
+	return std().EnsureLineInLines(lines, line, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+}
+
+// EnsureLineInLines is EnsureLineInLines using the settings of o.
+func (o *Ops) EnsureLineInLines(lines *[]string, line string, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
+	return o.EnsureLineInLinesWithOptions(lines, line, flagOptions(before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces))
+}
+
+// EnsureLineInFileRegexp ensures line is in textfile like
+// EnsureLineInFile, but the existing line to replace is located by
+// regular expression pattern, any other lines it matches are removed
+// and before/after (unless nil) are also regular expressions. Regular
+// expressions are matched against lines as is, leading and trailing
+// spaces included. If optional filePerm is specified, the first item
+// in the slice is used as file mode if textfile does not exist.
+// Returns error on failure.
+func EnsureLineInFileRegexp(textfile, line, pattern string, before, after *string, filePerm ...os.FileMode) error {
+	return std().EnsureLineInFileRegexp(textfile, line, pattern, before, after, filePerm...)
+}
+
+// EnsureLineInFileRegexp is EnsureLineInFileRegexp using the settings of o.
+func (o *Ops) EnsureLineInFileRegexp(textfile, line, pattern string, before, after *string, filePerm ...os.FileMode) error {
+	o.reportCall("EnsureLineInFileRegexp(%q, %q, %q, %+v, %+v)", textfile, line, pattern, before, after)
+	opts := regexpOptions(pattern, before, after)
+	opts.Create = true
+	if len(filePerm) > 0 {
+		opts.FileMode = filePerm[0]
 	}
+	_, err := o.ensureLineInFile(textfile, line, opts)
+	return err
+}
 
-	var lines []string
-	var originalLines []string
+// EnsureLineInLinesRegexp ensures line is in lines string pointer
+// slice like EnsureLineInLines, but the existing line to replace is
+// located by regular expression pattern, any other lines it matches
+// are removed and before/after (unless nil) are also regular
+// expressions. Returns error on failure, e.g if a
+// regular expression is invalid.
+func EnsureLineInLinesRegexp(lines *[]string, line, pattern string, before, after *string) error {
+	return std().EnsureLineInLinesRegexp(lines, line, pattern, before, after)
+}
 
-	// Read all lines from textfile
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		// If after and before is nil, avoid re-writing the file if the
-		// exact line already exists in the file.
-		if before == nil && after == nil && scanner.Text() == line {
-			return nil
-		}
-		lines = append(lines, scanner.Text())
+// EnsureLineInLinesRegexp is EnsureLineInLinesRegexp using the settings of o.
+func (o *Ops) EnsureLineInLinesRegexp(lines *[]string, line, pattern string, before, after *string) error {
+	return o.EnsureLineInLinesWithOptions(lines, line, regexpOptions(pattern, before, after))
+}
+
+// EnsureLineInFileWithOptions ensures line is in textfile. The
+// existing line (the first located by opts.Existing or line itself)
+// is removed and line is inserted after the first line matching
+// opts.After and/or before the first line matching opts.Before, or
+// appended if none of them match. Without anchors, the existing line
+// is replaced in place and line is appended if there is none. If
+// opts.Existing is set, all other lines it matches are removed.
+// Without anchors or opts.Existing, textfile is left untouched if the
+// exact line is already in it. If opts.ReplaceCommented is true, the
+// existing line, or else a commented-out version of it, is replaced
+// in place regardless of anchors. See LineOptions for how lines are
+// matched and other options. Returns a Result describing the change
+// or error on failure.
+func EnsureLineInFileWithOptions(textfile, line string, opts LineOptions) (Result, error) {
+	return std().EnsureLineInFileWithOptions(textfile, line, opts)
+}
+
+// EnsureLineInFileWithOptions is EnsureLineInFileWithOptions using the settings of o.
+func (o *Ops) EnsureLineInFileWithOptions(textfile, line string, opts LineOptions) (Result, error) {
+	o.reportCall("EnsureLineInFileWithOptions(%q, %q, %+v)", textfile, line, opts)
+	return o.ensureLineInFile(textfile, line, opts)
+}
+
+// EnsureLineInLinesWithOptions ensures line is in lines string
+// pointer slice like EnsureLineInFileWithOptions. Returns error on
+// failure.
+func EnsureLineInLinesWithOptions(lines *[]string, line string, opts LineOptions) error {
+	return std().EnsureLineInLinesWithOptions(lines, line, opts)
+}
+
+// EnsureLineInLinesWithOptions is EnsureLineInLinesWithOptions using the settings of o.
+func (o *Ops) EnsureLineInLinesWithOptions(lines *[]string, line string, opts LineOptions) error {
+	if lines == nil {
+		return o.orExit(errors.New("nil pointer"))
 	}
-	if err := scanner.Err(); err != nil {
-		return orExit(err)
+	existing, before, after, err := opts.matchers(opts.existing(line))
+	if err != nil {
+		return o.orExit(err)
 	}
-
-	if DryRun {
-		originalLines = make([]string, len(lines))
-		copy(originalLines, lines)
-		fmt.Fprintf(os.Stderr, "EnsureLineInFile(%q, %q, %+v, %+v, %t, %t)\n", textfile, line, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	ed := newLineEnsurer(line, existing, before, after, false)
+	ed.removeOthers = opts.Existing != ""
+	if opts.ReplaceCommented {
+		ed.comment = opts.comment()
 	}
+	*lines, _, _ = editSlice(ed, *lines)
+	return nil
+}
 
-	// Ensure line is in lines slice, lines slice will be modified
-	if err := EnsureLineInLines(&lines, line, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces); err != nil {
-		return orExit(err)
+// ensureLineInFile implements EnsureLineInFileWithOptions without
+// dry-run printing the call.
+func (o *Ops) ensureLineInFile(textfile, line string, opts LineOptions) (Result, error) {
+	existing, before, after, err := opts.matchers(opts.existing(line))
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
 	}
-
-	if DryRun {
-		// Show diff
-		origStrings := strings.Join(originalLines, "\n")
-		edits := myers.ComputeEdits(span.URIFromPath(path.Join("a", textfile)), origStrings, strings.Join(lines, "\n"))
-		diff := fmt.Sprint(gotextdiff.ToUnified(path.Join("a", textfile), path.Join("b", textfile), origStrings, edits))
-		if len(diff) > 0 {
-			fmt.Fprintln(os.Stderr, diff)
-		}
-		return nil
+	// If after and before is nil, avoid re-writing the file if the
+	// exact line already exists in the file.
+	ed := newLineEnsurer(line, existing, before, after, true)
+	ed.removeOthers = opts.Existing != ""
+	if opts.ReplaceCommented {
+		ed.comment = opts.comment()
 	}
+	return o.editLines(textfile, opts, ed)
+}
 
-	// Write lines back to textfile
-	if err := f.Truncate(0); err != nil {
-		return orExit(err)
+// lineEnsurer is a lineEditor removing the first line matching
+// existing (if any) and inserting line after the first remaining line
+// matching after and/or before the first remaining line matching
+// before. If before and after are nil, the line matching existing is
+// replaced in place. If there is no such line or the anchors do not
+// match any line, line is appended.
+type lineEnsurer struct {
+	line          string
+	existing      matcher
+	before, after anchor
+	keepExact     bool
+	// comment, unless empty, is the comment prefix of lines replaced
+	// in place if they match existing once uncommented
+	comment string
+	// i is the index of the line being scanned or edited
+	i int
+	// removeOthers is true if lines matching existing other than the
+	// one replaced are removed
+	removeOthers bool
+	// found is the index of the first line matching existing or -1
+	found int
+	// matches is the number of lines matching existing
+	matches int
+	// same is true if the line matching existing is line
+	same bool
+	// commented is the index of the commented-out line matching
+	// existing or -1
+	commented int
+	// exact is true if line already exists
+	exact bool
+	// skip is true if the lines are left untouched
+	skip bool
+	// insertBefore and insertAfter are the indices of the lines to
+	// insert line before or after, both -1 to append it
+	insertBefore, insertAfter int
+}
+
+// newLineEnsurer returns a lineEnsurer for line. If keepExact is true
+// and before and after are nil, the lines are left untouched if line
+// already exists.
+func newLineEnsurer(line string, existing, before, after matcher, keepExact bool) *lineEnsurer {
+	return &lineEnsurer{
+		line:      line,
+		existing:  existing,
+		before:    anchor{match: before},
+		after:     anchor{match: after},
+		keepExact: keepExact,
+		found:     -1,
+		commented: -1,
 	}
-	if _, err := f.Seek(0, 0); err != nil {
-		return orExit(err)
+}
+
+func (e *lineEnsurer) scan(line string) {
+	if e.existing(line) {
+		if e.found == -1 {
+			e.found, e.same = e.i, line == e.line
+		}
+		e.matches++
 	}
-	writer := bufio.NewWriter(f)
-	for _, line := range lines {
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			return orExit(err)
+	if e.comment != "" && e.commented == -1 {
+		if text, ok := uncomment(line, e.comment); ok && e.existing(text) {
+			e.commented = e.i
 		}
 	}
-	return orExit(writer.Flush())
+	if line == e.line {
+		e.exact = true
+	}
+	e.before.scan(e.i, line)
+	e.after.scan(e.i, line)
+	e.i++
 }
 
-// EnsureLineInLines ensures line is in lines string pointer slice,
-// optionally before and/or after string(s) unless before/after is/are
-// nil. Will trim leading and trailing spaces from line read from
-// lines before matching unless matchWithLeadingAndTrailingSpaces is
-// true. Will treat after and before as prefix unless
-// matchFullStringNotJustPrefix. Returns error on failure.
-func EnsureLineInLines(lines *[]string, line string, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
-	if lines == nil {
-		return orExit(errors.New("nil pointer"))
-	}
-
-	// Deref lines pointer
-	slice := *lines
-
-	// Function to find indices
-	findLine := func(target string) int {
-		for i, l := range slice {
-			if matchWithLeadingAndTrailingSpaces {
-				if matchFullStringNotJustPrefix {
-					if l == target {
-						return i
-					}
-				} else {
-					if strings.HasPrefix(l, target) {
-						return i
-					}
-				}
-			} else {
-				if matchFullStringNotJustPrefix {
-					if strings.TrimSpace(l) == target {
-						return i
-					}
-				} else {
-					if strings.HasPrefix(strings.TrimSpace(l), target) {
-						return i
-					}
-				}
+func (e *lineEnsurer) prepare() (Action, error) {
+	e.i = 0
+	anchored := e.before.match != nil || e.after.match != nil
+	if e.keepExact && !anchored && e.exact && (!e.removeOthers || e.found == -1) {
+		e.skip = true
+		return ActionNone, nil
+	}
+	if e.comment != "" || !anchored {
+		// Replace the existing, or else the commented-out, line in
+		// place
+		if e.found == -1 {
+			e.found = e.commented
+		}
+		if e.found != -1 {
+			if e.same && (!e.removeOthers || e.matches == 1) {
+				e.skip = true
+				return ActionNone, nil
 			}
+			e.insertBefore, e.insertAfter = e.found, -1
+			return ActionReplaced, nil
 		}
-		return -1
 	}
-
-	// Remove line if it already exists
-	lineIndex := findLine(line)
-	if lineIndex != -1 {
-		slice = append(slice[:lineIndex], slice[lineIndex+1:]...)
+	e.insertBefore, e.insertAfter = insertion(&e.before, &e.after, e.found)
+	switch {
+	case e.found == -1:
+		return ActionInserted, nil
+	case e.exact:
+		return ActionMoved, nil
 	}
+	return ActionReplaced, nil
+}
 
-	// Determine where to insert the line
-	insertIndex := len(slice) // default: at the end
-	if after != nil {
-		afterIndex := findLine(*after)
-		if afterIndex != -1 {
-			insertIndex = afterIndex + 1
-		}
+func (e *lineEnsurer) edit(line string, emit func(line string)) {
+	i := e.i
+	e.i++
+	switch {
+	case e.skip:
+		emit(line)
+		return
+	case i == e.found && i == e.insertBefore:
+		// Replaced in place
+		emit(e.line)
+		return
 	}
-	if before != nil {
-		beforeIndex := findLine(*before)
-		if beforeIndex != -1 {
-			insertIndex = beforeIndex
-		}
+	if i == e.insertBefore {
+		emit(e.line)
 	}
-
-	// Insert the line at the correct position
-	if insertIndex > len(slice) {
-		slice = append(slice, line)
-	} else {
-		slice = append(slice[:insertIndex], append([]string{line}, slice[insertIndex:]...)...)
+	if i != e.found && !(e.removeOthers && e.existing(line)) {
+		emit(line)
 	}
+	if i == e.insertAfter {
+		emit(e.line)
+	}
+}
 
-	*lines = slice
-	return nil
+func (e *lineEnsurer) end(emit func(line string)) {
+	if !e.skip && e.insertBefore == -1 && e.insertAfter == -1 {
+		emit(e.line)
+	}
 }
@@ -1,6 +1,9 @@
 package fileops
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -75,6 +78,13 @@ func TestEnsureLineInLines(t *testing.T) {
 		t.Fatal(err)
 	}
 	compareLines(t, &lines, expectedLines)
+
+	// An empty before prefix matches the first line
+	lines = []string{"a", "b"}
+	if err := EnsureLineInLines(&lines, "b", &[]string{""}[0], nil, false, false); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, []string{"b", "a"})
 }
 
 func compareLines(t *testing.T, lines *[]string, expectedLines []string) {
@@ -87,3 +97,115 @@ func compareLines(t *testing.T, lines *[]string, expectedLines []string) {
 		}
 	}
 }
+
+// lineEditTest is a test case editing a file of lines.
+type lineEditTest struct {
+	name     string
+	lines    []string
+	edit     func(textfile string) (Result, error)
+	action   Action
+	expected []string
+}
+
+// testLineEdits runs every test on a file of its own containing the
+// lines of the test, comparing the action and lines that result.
+func testLineEdits(t *testing.T, tests []lineEditTest) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textfile := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(textfile, []byte(strings.Join(tt.lines, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			result, err := tt.edit(textfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tt.action {
+				t.Errorf("Expected action %s, got %s", tt.action, result.Action)
+			}
+			content, err := os.ReadFile(textfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+			compareLines(t, &lines, tt.expected)
+		})
+	}
+}
+
+func TestEnsureLineInFileRegexp(t *testing.T) {
+	ensure := func(line string) func(textfile string) (Result, error) {
+		return func(textfile string) (Result, error) {
+			return EnsureLineInFileWithOptions(textfile, line, LineOptions{Match: MatchRegexp, Existing: `^port\s*=`})
+		}
+	}
+	testLineEdits(t, []lineEditTest{
+		{
+			name:     "replaced in place",
+			lines:    []string{"# app", "port = 22", "debug = false"},
+			edit:     ensure("port = 80"),
+			action:   ActionReplaced,
+			expected: []string{"# app", "port = 80", "debug = false"},
+		},
+		{
+			name:     "exact line elsewhere",
+			lines:    []string{"port = 22", "debug = false", "port = 80"},
+			edit:     ensure("port = 80"),
+			action:   ActionReplaced,
+			expected: []string{"port = 80", "debug = false"},
+		},
+		{
+			name:     "duplicates removed",
+			lines:    []string{"port = 80", "debug = false", "port = 22"},
+			edit:     ensure("port = 80"),
+			action:   ActionReplaced,
+			expected: []string{"port = 80", "debug = false"},
+		},
+		{
+			name:     "already in place",
+			lines:    []string{"port = 80", "debug = false"},
+			edit:     ensure("port = 80"),
+			action:   ActionNone,
+			expected: []string{"port = 80", "debug = false"},
+		},
+		{
+			name:     "appended",
+			lines:    []string{"debug = false"},
+			edit:     ensure("port = 80"),
+			action:   ActionInserted,
+			expected: []string{"debug = false", "port = 80"},
+		},
+	})
+}
+
+func TestEnsureLineInLinesRegexp(t *testing.T) {
+	lines := []string{
+		"[main]",
+		"  listen =  8080",
+		"[other]",
+	}
+
+	expectedLines := []string{
+		"[main]",
+		"listen = 9090",
+		"[other]",
+	}
+
+	after := `^\[main\]$`
+	if err := EnsureLineInLinesRegexp(&lines, "listen = 9090", `^\s*listen\s*=`, nil, &after); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, expectedLines)
+
+	before := `^\[other`
+	expectedLines = []string{
+		"[main]",
+		"listen = 9090",
+		"debug = true",
+		"[other]",
+	}
+	if err := EnsureLineInLinesRegexp(&lines, "debug = true", `^debug\s*=`, &before, nil); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, expectedLines)
+}
@@ -1,14 +1,20 @@
 package fileops
 
-import (
-	"os"
-	"os/user"
-)
+import "os"
 
 // Exists checks if a path (e.g file or directory) exists. Returns
 // true if the file or directory exists, false otherwise.
 func Exists(path string) bool {
-	_, err := os.Stat(path)
+	return std().Exists(path)
+}
+
+// Exists is Exists using the settings of o.
+func (o *Ops) Exists(path string) bool {
+	target, err := o.resolve(path)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(target)
 	if os.IsNotExist(err) {
 		return false
 	}
@@ -18,6 +24,12 @@ func Exists(path string) bool {
 // UserExists is a frontend for user.Lookup(username) returning true
 // if user exists, false if not.
 func UserExists(username string) bool {
-	_, err := user.Lookup(username)
+	return std().UserExists(username)
+}
+
+// UserExists is UserExists using the settings of o. If Root is set,
+// /etc/passwd under Root is consulted instead of the host's.
+func (o *Ops) UserExists(username string) bool {
+	_, err := o.lookupUser(username)
 	return err == nil
 }
@@ -1,16 +1,20 @@
 package fileops
 
-import (
-	"errors"
-	"os/user"
-)
+import "errors"
 
 // HomeDir returns the home directory of the specified user or an
 // error if the user does not exist.
 func HomeDir(username string) (string, error) {
-	usr, err := user.Lookup(username)
+	return std().HomeDir(username)
+}
+
+// HomeDir is HomeDir using the settings of o. If Root is set,
+// /etc/passwd under Root is consulted instead of the host's and the
+// home directory is returned as seen from inside Root.
+func (o *Ops) HomeDir(username string) (string, error) {
+	usr, err := o.lookupUser(username)
 	if err != nil {
-		return "", orExit(errors.New("user not found"))
+		return "", o.orExit(errors.New("user not found"))
 	}
 	return usr.HomeDir, nil
 }
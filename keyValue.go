@@ -0,0 +1,496 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DuplicateMode decides what SetKeyValueInFile does with a key set on
+// more than one line.
+type DuplicateMode int
+
+const (
+	// DuplicatesRemove sets the value on the first line setting the
+	// key and removes the others (the default).
+	DuplicatesRemove DuplicateMode = iota
+	// DuplicatesUpdate sets the value on every line setting the key.
+	DuplicatesUpdate
+	// DuplicatesAppend keeps every line setting the key and adds
+	// another one after the last of them unless the key is already
+	// set to the value, for keys that may be repeated (e.g HostKey in
+	// sshd_config).
+	DuplicatesAppend
+)
+
+// defaultSeparator separates key and value in lines added by
+// SetKeyValueInFile unless KeyValueOptions.Separator is set.
+const defaultSeparator = " = "
+
+// KeyValueOptions configures SetKeyValueInFile and RemoveKeyFromFile.
+// The zero value sets keys outside of any INI section, adding the key
+// with the separator of other lines (" = " if none) if it is missing.
+// Of the LineOptions, Match, Existing and Count are not used. Lines
+// starting with "#", ";" or LineOptions.Comment are comments, as is
+// the rest of a line from whitespace followed by one of them ("key =
+// value # comment"). Inline comments are not part of the value and
+// are kept when it is updated.
+type KeyValueOptions struct {
+	LineOptions
+	// Section, unless empty, is the INI section ("[Section]") of the
+	// key, created at the end of the file if missing. If empty, only
+	// lines before the first section header (or all lines if there are
+	// none, e.g in shell-style files) are considered.
+	Section string
+	// Separator separates key and value in lines written, e.g "=",
+	// ": " or " ". When an existing line is updated, its separator is
+	// kept unless Separator is set. New lines use the separator of the
+	// first line setting a key in the section, or else in the file,
+	// " = " if there is none. Existing lines are parsed with "=", ":"
+	// or whitespace as separator regardless of Separator.
+	Separator string
+	// Quote, unless empty, is the quote character (e.g `"` or `'`)
+	// surrounding values written. The value itself is written as is.
+	// When an existing line is updated, its quotes are kept unless
+	// Quote is set. Values are compared without quotes. Values that
+	// would otherwise be read back differently, e.g if they contain an
+	// inline comment, are quoted with `"` (or `'` if they contain `"`)
+	// if no quote is set.
+	Quote string
+	// IgnoreCase matches keys and sections case-insensitively.
+	IgnoreCase bool
+	// Duplicates decides what to do with a key set on more than one
+	// line, see DuplicateMode.
+	Duplicates DuplicateMode
+}
+
+// SetKeyValueInFile sets key to value in textfile, a configuration
+// file of "key = value", "key=value", "key: value" or "key value"
+// lines (shell-style, optionally prefixed by "export ", or INI-style
+// with sections). The first line setting key in opts.Section is
+// updated in place, keeping its indentation, separator and quotes
+// unless opts.Separator or opts.Quote are set, and other lines
+// setting key are handled according to opts.Duplicates. If key is not
+// set and opts.ReplaceCommented is true, a commented-out line setting
+// key is replaced in place. Otherwise, the line is inserted after the
+// first line in the section matching opts.After and/or before the
+// first line in the section matching opts.Before, or after the last
+// line of the section if there are no anchors or none of them match.
+// See KeyValueOptions for other options. Returns a Result describing
+// the change or error on failure, e.g if key is empty or contains
+// "=", ":" or whitespace, or if value contains a newline or needs
+// quotes but contains both `"` and `'`.
+func SetKeyValueInFile(textfile, key, value string, opts KeyValueOptions) (Result, error) {
+	return std().SetKeyValueInFile(textfile, key, value, opts)
+}
+
+// SetKeyValueInFile is SetKeyValueInFile using the settings of o.
+func (o *Ops) SetKeyValueInFile(textfile, key, value string, opts KeyValueOptions) (Result, error) {
+	o.reportCall("SetKeyValueInFile(%q, %q, %q, %+v)", textfile, key, value, opts)
+	ed, err := newKeyValueEditor(key, value, false, opts)
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
+	}
+	return o.editLines(textfile, opts.LineOptions, ed)
+}
+
+// SetKeyValueInLines sets key to value in lines string pointer slice
+// like SetKeyValueInFile. Returns error on failure.
+func SetKeyValueInLines(lines *[]string, key, value string, opts KeyValueOptions) error {
+	return std().SetKeyValueInLines(lines, key, value, opts)
+}
+
+// SetKeyValueInLines is SetKeyValueInLines using the settings of o.
+func (o *Ops) SetKeyValueInLines(lines *[]string, key, value string, opts KeyValueOptions) error {
+	return o.editKeyValueInLines(lines, key, value, false, opts)
+}
+
+// RemoveKeyFromFile removes every line setting key in opts.Section
+// from textfile, see SetKeyValueInFile. Returns a Result describing
+// the change or error on failure.
+func RemoveKeyFromFile(textfile, key string, opts KeyValueOptions) (Result, error) {
+	return std().RemoveKeyFromFile(textfile, key, opts)
+}
+
+// RemoveKeyFromFile is RemoveKeyFromFile using the settings of o.
+func (o *Ops) RemoveKeyFromFile(textfile, key string, opts KeyValueOptions) (Result, error) {
+	o.reportCall("RemoveKeyFromFile(%q, %q, %+v)", textfile, key, opts)
+	ed, err := newKeyValueEditor(key, "", true, opts)
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
+	}
+	return o.editLines(textfile, opts.LineOptions, ed)
+}
+
+// RemoveKeyFromLines removes key from lines string pointer slice like
+// RemoveKeyFromFile. Returns error on failure.
+func RemoveKeyFromLines(lines *[]string, key string, opts KeyValueOptions) error {
+	return std().RemoveKeyFromLines(lines, key, opts)
+}
+
+// RemoveKeyFromLines is RemoveKeyFromLines using the settings of o.
+func (o *Ops) RemoveKeyFromLines(lines *[]string, key string, opts KeyValueOptions) error {
+	return o.editKeyValueInLines(lines, key, "", true, opts)
+}
+
+// editKeyValueInLines implements SetKeyValueInLines and
+// RemoveKeyFromLines.
+func (o *Ops) editKeyValueInLines(lines *[]string, key, value string, remove bool, opts KeyValueOptions) error {
+	if lines == nil {
+		return o.orExit(errors.New("nil pointer"))
+	}
+	ed, err := newKeyValueEditor(key, value, remove, opts)
+	if err != nil {
+		return o.orExit(err)
+	}
+	*lines, _, _ = editSlice(ed, *lines)
+	return nil
+}
+
+// keyValue is a line setting a key split into its parts, e.g
+// `  Key = "value" # comment` or `export KEY=value`.
+type keyValue struct {
+	indent, export, key, sep, quote, value, comment string
+}
+
+// String returns kv as a line.
+func (kv keyValue) String() string {
+	return kv.indent + kv.export + kv.key + kv.sep + kv.quote + kv.value + kv.quote + kv.comment
+}
+
+// parseKeyValue splits line into a keyValue. The key ends at the first
+// "=", ":" or whitespace, after an "export " prefix if line is a shell
+// export of an assignment. The value ends at an inline comment,
+// whitespace followed by a comment (see isComment) after any quoted
+// value. Returns false if line is blank, a comment or a section
+// header.
+func parseKeyValue(line, comment string) (keyValue, bool) {
+	text := strings.TrimLeft(line, " \t")
+	if _, ok := parseSection(line); ok || text == "" || isComment(text, comment) {
+		return keyValue{}, false
+	}
+	kv := keyValue{indent: line[:len(line)-len(text)]}
+	if rest, ok := strings.CutPrefix(text, "export"); ok {
+		name := strings.TrimLeft(rest, " \t")
+		if i := strings.IndexAny(name, "=: \t"); len(name) < len(rest) && i > 0 && name[i] == '=' {
+			kv.export, text = text[:len(text)-len(name)], name
+		}
+	}
+	kv.key = text
+	i := strings.IndexAny(text, "=: \t")
+	if i == -1 {
+		return kv, true
+	}
+	kv.key = text[:i]
+	rest := text[i:]
+	j := len(rest) - len(strings.TrimLeft(rest, " \t"))
+	if j < len(rest) && (rest[j] == '=' || rest[j] == ':') {
+		j++
+		j += len(rest[j:]) - len(strings.TrimLeft(rest[j:], " \t"))
+	}
+	kv.sep = rest[:j]
+	value := rest[j:]
+	start := 0
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		if k := strings.IndexByte(value[1:], value[0]); k != -1 {
+			start = k + 2
+		}
+	}
+	if k := inlineComment(value[start:], comment); k != -1 {
+		kv.comment = value[start+k:]
+		value = value[:start+k]
+	}
+	kv.value = strings.TrimRight(value, " \t")
+	kv.comment = value[len(kv.value):] + kv.comment
+	if v := kv.value; len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		kv.quote, kv.value = v[:1], v[1:len(v)-1]
+	}
+	return kv, true
+}
+
+// parseSection returns the name of the INI section line starts and
+// true if line is a section header, e.g "[name]".
+func parseSection(line string) (string, bool) {
+	text := strings.TrimSpace(line)
+	if len(text) < 2 || text[0] != '[' || text[len(text)-1] != ']' {
+		return "", false
+	}
+	return strings.TrimSpace(text[1 : len(text)-1]), true
+}
+
+// inlineComment returns the index of the whitespace starting an
+// inline comment in value or -1 if there is none.
+func inlineComment(value, comment string) int {
+	for i := 0; i < len(value); i++ {
+		if (value[i] == ' ' || value[i] == '\t') && isComment(value[i+1:], comment) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isComment reports whether text (without indentation) starts with
+// "#", ";" or comment.
+func isComment(text, comment string) bool {
+	return strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") || comment != "" && strings.HasPrefix(text, comment)
+}
+
+// keyValueEditor is a lineEditor setting or removing a key in a
+// section, see SetKeyValueInFile.
+type keyValueEditor struct {
+	key, value    string
+	remove        bool
+	opts          KeyValueOptions
+	before, after anchor
+	// i is the index of the line being scanned or edited
+	i int
+	// inSection is true if the current line is in the section
+	inSection bool
+	// sections is the number of times the section has started
+	sections int
+	// header is the index of the first header of the section or -1
+	header int
+	// firstHeader is the index of the first section header or -1
+	firstHeader int
+	// last is the index of the last non-blank line of the first
+	// occurrence of the section (including its header) or -1
+	last int
+	// lastBlank is true if the last line is blank
+	lastBlank bool
+	// sep and fileSep are the separators of the first lines setting
+	// a key in the section and in the file, see separator
+	sep, fileSep string
+	// firstKey and lastKey are the indices of the first and last
+	// lines setting the key or -1
+	firstKey, lastKey int
+	// isSet is true if a line already sets the key to value
+	isSet bool
+	// commented is the index of the first commented-out line setting
+	// the key or -1
+	commented int
+	// skip is true if the lines are left untouched
+	skip bool
+	// insert is true if a line setting the key is added
+	insert bool
+	// insertBefore and insertAfter are the indices of the lines to
+	// insert the key before or after, both -1 to add it at the end
+	insertBefore, insertAfter int
+}
+
+// newKeyValueEditor returns a keyValueEditor setting key to value or
+// removing it if remove is true. Returns error if key is empty or
+// contains a separator, if value spans lines or if an anchor is an
+// invalid regular expression.
+func newKeyValueEditor(key, value string, remove bool, opts KeyValueOptions) (*keyValueEditor, error) {
+	switch {
+	case key == "":
+		return nil, errors.New("empty key")
+	case strings.ContainsAny(key, "=: \t\r\n"):
+		return nil, fmt.Errorf("invalid key %q", key)
+	case strings.ContainsAny(value, "\r\n"):
+		return nil, fmt.Errorf("value of %s contains a newline", key)
+	case opts.Quote == "" && strings.Contains(value, `"`) && strings.Contains(value, "'") && needsQuotes(value, opts.Comment):
+		return nil, fmt.Errorf("value of %s needs quotes but contains both \" and '", key)
+	}
+	_, before, after, err := opts.matchers("")
+	if err != nil {
+		return nil, err
+	}
+	return &keyValueEditor{
+		key:          key,
+		value:        value,
+		remove:       remove,
+		opts:         opts,
+		before:       anchor{match: before},
+		after:        anchor{match: after},
+		inSection:    opts.Section == "",
+		header:       -1,
+		firstHeader:  -1,
+		last:         -1,
+		firstKey:     -1,
+		lastKey:      -1,
+		commented:    -1,
+		insertBefore: -1,
+		insertAfter:  -1,
+	}, nil
+}
+
+// equal compares keys or section names according to IgnoreCase.
+func (e *keyValueEditor) equal(a, b string) bool {
+	if e.opts.IgnoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// next updates the section state with line. Returns true if line is a
+// section header.
+func (e *keyValueEditor) next(line string) bool {
+	name, ok := parseSection(line)
+	if ok {
+		e.inSection = e.opts.Section != "" && e.equal(name, e.opts.Section)
+		if e.inSection {
+			e.sections++
+		}
+	}
+	return ok
+}
+
+// keyLine returns line parsed and true if it sets the key.
+func (e *keyValueEditor) keyLine(line string) (keyValue, bool) {
+	kv, ok := parseKeyValue(line, e.opts.Comment)
+	return kv, ok && e.equal(kv.key, e.key)
+}
+
+func (e *keyValueEditor) scan(line string) {
+	i := e.i
+	e.i++
+	e.lastBlank = strings.TrimSpace(line) == ""
+	if e.next(line) {
+		if e.firstHeader == -1 {
+			e.firstHeader = i
+		}
+		if e.inSection && e.header == -1 {
+			e.header, e.last = i, i
+		}
+		return
+	}
+	kv, isKV := parseKeyValue(line, e.opts.Comment)
+	if isKV && e.fileSep == "" {
+		e.fileSep = kv.sep
+	}
+	if !e.inSection {
+		return
+	}
+	if isKV && e.sep == "" {
+		e.sep = kv.sep
+	}
+	if e.sections <= 1 && !e.lastBlank {
+		e.last = i
+	}
+	e.before.scan(i, line)
+	e.after.scan(i, line)
+	if isKV && e.equal(kv.key, e.key) {
+		if e.firstKey == -1 {
+			e.firstKey = i
+		}
+		e.lastKey = i
+		e.isSet = e.isSet || kv.value == e.value
+	} else if text, ok := uncomment(line, e.opts.comment()); ok && e.commented == -1 {
+		if _, ok := e.keyLine(text); ok {
+			e.commented = i
+		}
+	}
+}
+
+func (e *keyValueEditor) prepare() (Action, error) {
+	e.i, e.inSection, e.sections = 0, e.opts.Section == "", 0
+	switch {
+	case e.remove:
+		return ActionRemoved, nil
+	case e.opts.Duplicates == DuplicatesAppend && e.isSet:
+		e.skip = true
+		return ActionNone, nil
+	case e.opts.Duplicates == DuplicatesAppend && e.firstKey != -1:
+		e.insert, e.insertAfter = true, e.lastKey
+		return ActionInserted, nil
+	case e.firstKey != -1:
+		return ActionReplaced, nil
+	case e.opts.ReplaceCommented && e.commented != -1:
+		return ActionReplaced, nil
+	}
+	e.insert = true
+	e.insertBefore, e.insertAfter = insertion(&e.before, &e.after, -1)
+	switch {
+	case e.insertBefore != -1 || e.insertAfter != -1:
+	case e.last != -1:
+		e.insertAfter = e.last
+	case e.opts.Section == "" && e.firstHeader != -1:
+		e.insertBefore = e.firstHeader
+	}
+	return ActionInserted, nil
+}
+
+func (e *keyValueEditor) edit(line string, emit func(line string)) {
+	i := e.i
+	e.i++
+	header := e.next(line)
+	if i == e.insertBefore {
+		emit(e.newLine())
+	}
+	kv, isKey := e.keyLine(line)
+	isKey = isKey && !header && e.inSection && !e.skip
+	switch {
+	case isKey && e.remove:
+	case isKey && e.opts.Duplicates == DuplicatesAppend:
+		emit(line)
+	case isKey && (i == e.firstKey || e.opts.Duplicates == DuplicatesUpdate):
+		emit(e.update(kv))
+	case isKey:
+		// Remove duplicate
+	case i == e.commented && e.firstKey == -1 && e.opts.ReplaceCommented && !e.remove:
+		text, _ := uncomment(line, e.opts.comment())
+		kv, _ := e.keyLine(text)
+		emit(e.update(kv))
+	default:
+		emit(line)
+	}
+	if i == e.insertAfter {
+		emit(e.newLine())
+	}
+}
+
+func (e *keyValueEditor) end(emit func(line string)) {
+	if !e.insert || e.insertBefore != -1 || e.insertAfter != -1 {
+		return
+	}
+	if e.opts.Section != "" {
+		if e.i > 0 && !e.lastBlank {
+			emit("")
+		}
+		emit("[" + e.opts.Section + "]")
+	}
+	emit(e.newLine())
+}
+
+// update returns kv set to the value, with the separator and quotes
+// of the options if set.
+func (e *keyValueEditor) update(kv keyValue) string {
+	kv.value = e.value
+	if e.opts.Separator != "" || kv.sep == "" {
+		kv.sep = e.separator()
+	}
+	if e.opts.Quote != "" {
+		kv.quote = e.opts.Quote
+	}
+	if kv.quote == "" && needsQuotes(kv.value, e.opts.Comment) {
+		kv.quote = `"`
+		if strings.Contains(kv.value, `"`) {
+			kv.quote = "'"
+		}
+	}
+	return kv.String()
+}
+
+// needsQuotes reports whether unquoted value would not be parsed back
+// as is by parseKeyValue, i.e if it starts with a quote, has leading
+// or trailing whitespace or contains an inline comment.
+func needsQuotes(value, comment string) bool {
+	return strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") || strings.Trim(value, " \t") != value || inlineComment(value, comment) != -1
+}
+
+// separator returns the separator of new lines, see
+// KeyValueOptions.Separator.
+func (e *keyValueEditor) separator() string {
+	for _, sep := range []string{e.opts.Separator, e.sep, e.fileSep} {
+		if sep != "" {
+			return sep
+		}
+	}
+	return defaultSeparator
+}
+
+// newLine returns a new line setting the key to the value.
+func (e *keyValueEditor) newLine() string {
+	return e.update(keyValue{key: e.key})
+}
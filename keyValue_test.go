@@ -0,0 +1,149 @@
+package fileops
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetKeyValueInFile(t *testing.T) {
+	o := &Ops{}
+	ini := []string{
+		"; global settings",
+		"name=demo",
+		"",
+		"[server]",
+		"  port: 8080",
+		`host = "localhost"`,
+		"#timeout = 10",
+		"",
+		"[client]",
+		"retries 3",
+		"retries 5",
+	}
+	// edited returns ini with line i replaced by lines
+	edited := func(i int, lines ...string) []string {
+		return slices.Concat(ini[:i], lines, ini[i+1:])
+	}
+	testLineEdits(t, []lineEditTest{
+		{"same value", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "name", "demo", KeyValueOptions{})
+		}, ActionNone, ini},
+		{"global", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "name", "prod", KeyValueOptions{})
+		}, ActionReplaced, edited(1, "name=prod")},
+		{"global insert", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "debug", "false", KeyValueOptions{})
+		}, ActionInserted, edited(1, "name=demo", "debug=false")},
+		{"keep separator", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "PORT", "9090", KeyValueOptions{Section: "server", IgnoreCase: true})
+		}, ActionReplaced, edited(4, "  port: 9090")},
+		{"keep quotes", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "host", "localhost", KeyValueOptions{Section: "server"})
+		}, ActionNone, ini},
+		{"replace commented", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "timeout", "30", KeyValueOptions{Section: "server", LineOptions: LineOptions{ReplaceCommented: true}})
+		}, ActionReplaced, edited(6, "timeout = 30")},
+		{"section insert", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "tls", "on", KeyValueOptions{Section: "server", Separator: " = ", Quote: `"`})
+		}, ActionInserted, edited(6, "#timeout = 10", `tls = "on"`)},
+		{"duplicates", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "retries", "4", KeyValueOptions{Section: "client"})
+		}, ActionReplaced, slices.Concat(ini[:9], []string{"retries 4"})},
+		{"anchor", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "backoff", "1s", KeyValueOptions{Section: "client", LineOptions: LineOptions{Before: "retries"}})
+		}, ActionInserted, edited(9, "backoff 1s", "retries 3")},
+		{"new section", ini, func(textfile string) (Result, error) {
+			return o.SetKeyValueInFile(textfile, "level", "info", KeyValueOptions{Section: "log"})
+		}, ActionInserted, slices.Concat(ini, []string{"", "[log]", "level=info"})},
+		{"remove", ini, func(textfile string) (Result, error) {
+			return o.RemoveKeyFromFile(textfile, "retries", KeyValueOptions{Section: "client"})
+		}, ActionRemoved, ini[:9]},
+		{"remove none", ini, func(textfile string) (Result, error) {
+			return o.RemoveKeyFromFile(textfile, "host", KeyValueOptions{Section: "client"})
+		}, ActionNone, ini},
+	})
+}
+
+func TestSetKeyValueInLines(t *testing.T) {
+	lines := []string{"HostKey /etc/ssh/ssh_host_rsa_key", "PermitRootLogin yes", "PermitRootLogin no"}
+	opts := KeyValueOptions{Duplicates: DuplicatesAppend}
+	for range 2 {
+		if err := SetKeyValueInLines(&lines, "HostKey", "/etc/ssh/ssh_host_ed25519_key", opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compareLines(t, &lines, []string{"HostKey /etc/ssh/ssh_host_rsa_key", "HostKey /etc/ssh/ssh_host_ed25519_key", "PermitRootLogin yes", "PermitRootLogin no"})
+
+	lines = []string{"PermitRootLogin yes", "PermitRootLogin no"}
+	if err := SetKeyValueInLines(&lines, "PermitRootLogin", "prohibit-password", KeyValueOptions{Duplicates: DuplicatesUpdate}); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, []string{"PermitRootLogin prohibit-password", "PermitRootLogin prohibit-password"})
+
+	lines = []string{"HostKey /etc/ssh/ssh_host_rsa_key", "UsePAM yes"}
+	if err := SetKeyValueInLines(&lines, "Port", "22", KeyValueOptions{LineOptions: LineOptions{After: "HostKey"}}); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, []string{"HostKey /etc/ssh/ssh_host_rsa_key", "Port 22", "UsePAM yes"})
+
+	if err := RemoveKeyFromLines(&lines, "HostKey", KeyValueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, []string{"Port 22", "UsePAM yes"})
+}
+
+func TestSetKeyValueInvalid(t *testing.T) {
+	for _, kv := range [][2]string{{"", "x"}, {"a b", "x"}, {"a:b", "x"}, {"a=b", "x"}, {"x", "1\ny=2"}, {"x", `"a" # 'b'`}} {
+		lines := []string{"a = 1"}
+		if err := SetKeyValueInLines(&lines, kv[0], kv[1], KeyValueOptions{}); err == nil {
+			t.Errorf("Expected error setting %q to %q", kv[0], kv[1])
+		}
+		compareLines(t, &lines, []string{"a = 1"})
+	}
+}
+
+func TestSetKeyValueInShellFile(t *testing.T) {
+	lines := []string{"# environment", "export PATH=/usr/bin", "LANG=C"}
+	for _, kv := range [][2]string{{"PATH", "/usr/local/bin:/usr/bin"}, {"EDITOR", "vi"}, {"LANG", "C"}} {
+		if err := SetKeyValueInLines(&lines, kv[0], kv[1], KeyValueOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compareLines(t, &lines, []string{"# environment", "export PATH=/usr/local/bin:/usr/bin", "LANG=C", "EDITOR=vi"})
+}
+
+func TestSetKeyValueQuoted(t *testing.T) {
+	// setTwice sets key to value twice, returning the Result of the
+	// second time
+	setTwice := func(key, value string) func(textfile string) (Result, error) {
+		return func(textfile string) (Result, error) {
+			if _, err := SetKeyValueInFile(textfile, key, value, KeyValueOptions{}); err != nil {
+				return Result{}, err
+			}
+			return SetKeyValueInFile(textfile, key, value, KeyValueOptions{})
+		}
+	}
+	lines := []string{"a = 1 # note"}
+	testLineEdits(t, []lineEditTest{
+		{"inline comment", lines, setTwice("a", "x # y"), ActionNone, []string{`a = "x # y" # note`}},
+		{"semicolon comment", lines, setTwice("b", "x ; y"), ActionNone, []string{"a = 1 # note", `b = "x ; y"`}},
+		{"double quotes", lines, setTwice("c", `say "hi" # now`), ActionNone, []string{"a = 1 # note", `c = 'say "hi" # now'`}},
+		{"leading space", lines, setTwice("d", " padded"), ActionNone, []string{"a = 1 # note", `d = " padded"`}},
+		{"quoted value", lines, setTwice("e", `"quoted"`), ActionNone, []string{"a = 1 # note", `e = '"quoted"'`}},
+		{"plain value", lines, setTwice("a", "#fff"), ActionNone, []string{"a = #fff # note"}},
+	})
+}
+
+func TestSetKeyValueInlineComment(t *testing.T) {
+	lines := []string{"a = 1 # note", `b = "x # y" ; quoted`, "c=#fff"}
+	for _, kv := range [][2]string{{"a", "1"}, {"b", "x # y"}, {"c", "#fff"}} {
+		if err := SetKeyValueInLines(&lines, kv[0], kv[1], KeyValueOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compareLines(t, &lines, []string{"a = 1 # note", `b = "x # y" ; quoted`, "c=#fff"})
+	if err := SetKeyValueInLines(&lines, "a", "2", KeyValueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, []string{"a = 2 # note", `b = "x # y" ; quoted`, "c=#fff"})
+}
@@ -0,0 +1,355 @@
+package fileops
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"strings"
+)
+
+// utf8BOM is the UTF-8 byte order mark.
+const utf8BOM = "\ufeff"
+
+// lineFormat is how the lines of a text file are encoded, preserved
+// when the lines are written back.
+type lineFormat struct {
+	// bom is true if the content starts with a UTF-8 BOM.
+	bom bool
+	// crlf is true if lines end with CRLF rather than LF.
+	crlf bool
+	// finalNewline is true if the last line is terminated.
+	finalNewline bool
+}
+
+// defaultLineFormat is the format of new and normalized files.
+var defaultLineFormat = lineFormat{finalNewline: true}
+
+// lineReader reads lines of any length from a stream without line
+// terminators (and BOM), keeping track of their format.
+type lineReader struct {
+	r       *bufio.Reader
+	format  lineFormat
+	crlf    int // lines terminated by CRLF
+	lf      int // lines terminated by LF only
+	started bool
+	// err is the error that ended reading, if any
+	err error
+}
+
+// newLineReader returns a lineReader reading lines from r.
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReader(r), format: defaultLineFormat}
+}
+
+// next returns the next line and true, or false at the end of the
+// stream or on error, see lr.err. A CR before LF is stripped from
+// every line, even if most lines end with LF only.
+func (lr *lineReader) next() (string, bool) {
+	line, err := lr.r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		lr.err = err
+		return "", false
+	}
+	if !lr.started {
+		lr.started = true
+		line, lr.format.bom = strings.CutPrefix(line, utf8BOM)
+	}
+	if line == "" {
+		return "", false
+	}
+	if l, ok := strings.CutSuffix(line, "\n"); ok {
+		if line, ok = strings.CutSuffix(l, "\r"); ok {
+			lr.crlf++
+		} else {
+			lr.lf++
+		}
+	} else {
+		lr.format.finalNewline = false
+	}
+	return line, true
+}
+
+// lineFormat returns the format of the lines read so far. Lines end
+// with CRLF if most terminated lines do, otherwise LF, so that a file
+// mixing line endings is written back consistently with the most
+// common one (LF on a tie).
+func (lr *lineReader) lineFormat() lineFormat {
+	format := lr.format
+	format.crlf = lr.crlf > lr.lf
+	return format
+}
+
+// lineWriter writes lines encoded according to a lineFormat to a
+// stream.
+type lineWriter struct {
+	w      *bufio.Writer
+	format lineFormat
+	n      int
+}
+
+// newLineWriter returns a lineWriter writing lines encoded according
+// to format to w.
+func newLineWriter(w io.Writer, format lineFormat) *lineWriter {
+	return &lineWriter{w: bufio.NewWriter(w), format: format}
+}
+
+// write writes line, errors are returned by close.
+func (lw *lineWriter) write(line string) {
+	if lw.n == 0 {
+		lw.writeBOM()
+	} else {
+		lw.writeEOL()
+	}
+	lw.w.WriteString(line)
+	lw.n++
+}
+
+// close terminates the last line (unless the format says otherwise)
+// and flushes everything written. Returns error on failure.
+func (lw *lineWriter) close() error {
+	if lw.n == 0 {
+		lw.writeBOM()
+	} else if lw.format.finalNewline {
+		lw.writeEOL()
+	}
+	return lw.w.Flush()
+}
+
+func (lw *lineWriter) writeBOM() {
+	if lw.format.bom {
+		lw.w.WriteString(utf8BOM)
+	}
+}
+
+func (lw *lineWriter) writeEOL() {
+	if lw.format.crlf {
+		lw.w.WriteString("\r\n")
+	} else {
+		lw.w.WriteString("\n")
+	}
+}
+
+// lineEditor edits lines streamed through it. Lines are streamed
+// twice, first to scan and then to edit them, so that files of any
+// size can be edited without holding all lines in memory.
+type lineEditor interface {
+	// scan is called with every line in order before editing, e.g to
+	// locate anchors.
+	scan(line string)
+	// prepare is called after the last line has been scanned and
+	// returns the Action the edit takes or error if it can not be
+	// made.
+	prepare() (Action, error)
+	// edit is called with every line in order and passes the lines
+	// replacing it to emit.
+	edit(line string, emit func(line string))
+	// end passes lines to append after the last line to emit.
+	end(emit func(line string))
+}
+
+// editSlice applies ed to lines. Returns the edited lines and the
+// Action taken or error if the edit can not be made.
+func editSlice(ed lineEditor, lines []string) ([]string, Action, error) {
+	for _, line := range lines {
+		ed.scan(line)
+	}
+	action, err := ed.prepare()
+	if err != nil {
+		return lines, ActionNone, err
+	}
+	edited := make([]string, 0, len(lines)+1)
+	emit := func(line string) { edited = append(edited, line) }
+	for _, line := range lines {
+		ed.edit(line, emit)
+	}
+	ed.end(emit)
+	return edited, action, nil
+}
+
+// anchor tracks the first lines matching an anchor, enough to find
+// the first one other than a line removed by the edit.
+type anchor struct {
+	match matcher
+	found []int
+}
+
+// scan records line i if it is one of the first two matching lines.
+func (a *anchor) scan(i int, line string) {
+	if a.match != nil && len(a.found) < 2 && a.match(line) {
+		a.found = append(a.found, i)
+	}
+}
+
+// index returns the index of the first matching line other than line
+// skip or -1 if there is none.
+func (a *anchor) index(skip int) int {
+	for _, i := range a.found {
+		if i != skip {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertion returns the index of the line to insert before, or else
+// the index of the line to insert after, given the before and after
+// anchors and ignoring line skip. Both are -1 if neither anchor
+// matches any line, i.e insert at the end.
+func insertion(before, after *anchor, skip int) (beforeIndex, afterIndex int) {
+	if beforeIndex = before.index(skip); beforeIndex != -1 {
+		return beforeIndex, -1
+	}
+	return -1, after.index(skip)
+}
+
+// editLines streams the lines of textfile through ed into a temporary
+// file atomically replacing textfile unless the lines are unchanged,
+// see lineEditor. Line endings, BOM and final newline are preserved
+// unless opts.Normalize is true. If textfile does not exist, ed is
+// given no lines if opts.Create is true (textfile is then created
+// with opts.FileMode), otherwise error is returned. opts.Owner,
+// opts.Group and opts.Backup are also honored. In dry-run mode, a
+// diff is printed instead of writing to textfile. Returns a Result
+// describing the change or error on failure.
+func (o *Ops) editLines(textfile string, opts LineOptions, ed lineEditor) (result Result, err error) {
+	defer func() { o.logResult(result, err) }()
+	result = Result{Action: ActionNone, Path: textfile}
+	filename, err := o.resolve(textfile)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+
+	// Hold a lock on textfile during the whole read-modify-write cycle
+	locked, unlock, err := o.lockTarget(filename)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+	defer unlock()
+
+	// Scan all lines of textfile unless it does not exist yet
+	before := newDiffBuffer()
+	format, err := scanLines(filename, before, ed.scan)
+	exists := err == nil
+	switch {
+	case exists:
+		result.BeforeHash = before.hash()
+		result.AfterHash = result.BeforeHash
+	case !os.IsNotExist(err) || !opts.Create:
+		return result, o.orExit(err)
+	}
+
+	action, err := ed.prepare()
+	if err != nil {
+		return result, o.orExit(err)
+	}
+
+	newFormat := format
+	if opts.Normalize {
+		newFormat = defaultLineFormat
+	}
+	after := newDiffBuffer()
+	changed := false
+	edit := func(w io.Writer) (bool, error) {
+		changed, err = editPass(filename, exists, ed, newFormat, io.MultiWriter(w, after))
+		return changed || newFormat != format, err
+	}
+	if o.DryRun {
+		_, err = edit(io.Discard)
+	} else {
+		// Atomically replace textfile with the edited lines
+		_, err = locked.withBackup(opts.Backup).withValidator(opts.validator()).writeFileAtomicFunc(filename, opts.fileMode(), false, edit)
+	}
+	if err != nil {
+		return result, o.orExit(err)
+	}
+
+	if changed || newFormat != format {
+		if !changed {
+			action = ActionUpdated
+		}
+		result.Changed = true
+		result.Action = action
+		result.AfterHash = after.hash()
+		result.Diff = o.lineDiff(textfile, before, after)
+		o.report(Event{Kind: lineEvent(action), Path: textfile, Action: action, Diff: result.Diff})
+	} else if !exists {
+		// Nothing to do for a missing file that would remain empty
+		return result, nil
+	}
+
+	changed, err = o.ensureOwnership(filename, opts.Owner, opts.Group)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+	if changed && !result.Changed {
+		result.Changed = true
+		result.Action = ActionUpdated
+	}
+	return result, nil
+}
+
+// scanLines passes every line of filename to scan and copies the raw
+// content to w. Returns the format of the lines or error on failure,
+// including os.ErrNotExist if filename does not exist.
+func scanLines(filename string, w io.Writer, scan func(line string)) (lineFormat, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return defaultLineFormat, err
+	}
+	defer f.Close()
+	lr := newLineReader(io.TeeReader(f, w))
+	for line, ok := lr.next(); ok; line, ok = lr.next() {
+		scan(line)
+	}
+	return lr.lineFormat(), lr.err
+}
+
+// editPass streams the lines of filename (none unless exists) through
+// ed and writes the edited lines encoded according to format to w.
+// Returns whether the lines changed or error on failure.
+func editPass(filename string, exists bool, ed lineEditor, format lineFormat, w io.Writer) (bool, error) {
+	in, out := sha256.New(), sha256.New()
+	lw := newLineWriter(w, format)
+	emit := func(line string) {
+		lw.write(line)
+		io.WriteString(out, line)
+		io.WriteString(out, "\n")
+	}
+	if exists {
+		f, err := os.Open(filename)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		lr := newLineReader(f)
+		for line, ok := lr.next(); ok; line, ok = lr.next() {
+			io.WriteString(in, line)
+			io.WriteString(in, "\n")
+			ed.edit(line, emit)
+		}
+		if lr.err != nil {
+			return false, lr.err
+		}
+	}
+	ed.end(emit)
+	if err := lw.close(); err != nil {
+		return false, err
+	}
+	return !bytes.Equal(in.Sum(nil), out.Sum(nil)), nil
+}
+
+// lineEvent returns the EventKind reporting a line edit resulting in
+// action.
+func lineEvent(action Action) EventKind {
+	switch action {
+	case ActionInserted, ActionMoved:
+		return EventLineInserted
+	case ActionReplaced:
+		return EventLineReplaced
+	case ActionRemoved:
+		return EventLineRemoved
+	}
+	return EventFileWritten
+}
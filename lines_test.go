@@ -0,0 +1,88 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineFormat(t *testing.T) {
+	o := &Ops{}
+	textfile := filepath.Join(t.TempDir(), "config")
+
+	tests := []struct {
+		name      string
+		content   string
+		line      string
+		normalize bool
+		action    Action
+		expected  string
+	}{
+		{"crlf", "a\r\nb\r\n", "c", false, ActionInserted, "a\r\nb\r\nc\r\n"},
+		{"bom", "\ufeffa\nb\n", "a", false, ActionNone, "\ufeffa\nb\n"},
+		{"bom insert", "\ufeffa\n", "b", false, ActionInserted, "\ufeffa\nb\n"},
+		{"no final newline", "a\nb", "c", false, ActionInserted, "a\nb\nc"},
+		{"mixed crlf", "a\r\nb\r\nc\n", "d", false, ActionInserted, "a\r\nb\r\nc\r\nd\r\n"},
+		{"mixed tie", "a\r\nb\n", "c", false, ActionInserted, "a\nb\nc\n"},
+		{"mixed unchanged", "a\r\nb\n", "a", false, ActionNone, "a\r\nb\n"},
+		{"normalize", "\ufeffa\r\nb", "a", true, ActionUpdated, "a\nb\n"},
+		{"normalized", "a\nb\n", "a", true, ActionNone, "a\nb\n"},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(textfile, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result, err := o.EnsureLineInFileWithOptions(textfile, tt.line, LineOptions{Match: MatchFull, Normalize: tt.normalize})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Action != tt.action {
+			t.Errorf("%s: expected action %s, got %s", tt.name, tt.action, result.Action)
+		}
+		content, err := os.ReadFile(textfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, content)
+		}
+		if result.Changed && result.AfterHash != hashContent(content) {
+			t.Errorf("%s: AfterHash does not match the written content", tt.name)
+		}
+	}
+}
+
+func TestLongLines(t *testing.T) {
+	o := &Ops{}
+	textfile := filepath.Join(t.TempDir(), "authorized_keys")
+	long := "ssh-ed25519 " + strings.Repeat("A", 2*maxDiffSize)
+	if err := os.WriteFile(textfile, []byte("first\n"+long+"\nlast\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := o.EnsureLineInFileWithOptions(textfile, "second", LineOptions{After: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionInserted || !strings.HasPrefix(result.Diff, "Files ") {
+		t.Errorf("Expected line inserted with a size summary, got %s and %q", result, result.Diff)
+	}
+	result, err = o.ReplaceLineInFileWithOptions(textfile, "ssh-ed25519 ", "ssh-ed25519 B", LineOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionReplaced {
+		t.Errorf("Expected long line replaced, got %s", result)
+	}
+	content, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "first\nsecond\nssh-ed25519 B\nlast\n"; string(content) != expected {
+		t.Errorf("Expected %q, got %d bytes", expected, len(content))
+	}
+	if result.AfterHash != hashContent(content) {
+		t.Error("AfterHash does not match the written content")
+	}
+}
@@ -0,0 +1,308 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrLockTimeout is returned (wrapped) when a file lock could not be
+// acquired within LockTimeout.
+var ErrLockTimeout = errors.New("timeout waiting for file lock")
+
+// ErrLockHeld is returned (wrapped) when a file is edited through an
+// Ops other than the one passed to fn while WithFileLock holds the
+// lock on it in the same process.
+var ErrLockHeld = errors.New("file locked by WithFileLock")
+
+// Package wide variable setting how long to wait for a file lock
+// before giving up with ErrLockTimeout. 0 waits forever.
+var LockTimeout time.Duration = 0
+
+// SetLockTimeout can be used to set package-wide lock timeout, see
+// LockTimeout.
+func SetLockTimeout(timeout time.Duration) {
+	LockTimeout = timeout
+}
+
+// lockPollInterval is how often a lock is retried while waiting for
+// it with a timeout.
+const lockPollInterval = 10 * time.Millisecond
+
+// WithFileLock calls fn while holding an exclusive advisory lock
+// (flock(2)) on path, waiting at most LockTimeout for it. If path
+// does not exist, the nearest existing parent directory is locked
+// until path is created. The line editors and PutFile take the same
+// lock around every read-modify-write cycle, so WithFileLock makes
+// several edits of path atomic to other processes and goroutines
+// doing the same. fn is passed a copy of the Ops holding the lock,
+// its editors and nested WithFileLock calls on path reuse the lock
+// instead of waiting for it. Edits of path inside fn must use that
+// Ops, edits using any other Ops (e.g the top-level functions) fail
+// with ErrLockHeld instead of waiting for the lock forever. Returns
+// error if the lock could not be acquired, otherwise the error
+// returned by fn.
+func WithFileLock(path string, fn func(o *Ops) error) error {
+	return std().WithFileLock(path, fn)
+}
+
+// WithFileLock is WithFileLock using the settings of o.
+func (o *Ops) WithFileLock(path string, fn func(o *Ops) error) error {
+	return o.withFileLock(path, false, fn)
+}
+
+// WithSharedFileLock is WithFileLock taking a shared lock, for
+// readers of path that only need to keep it from being modified while
+// fn runs. The Ops passed to fn can not modify path, only dry-run
+// edits share the lock. Returns error if the lock could not be
+// acquired, otherwise the error returned by fn.
+func WithSharedFileLock(path string, fn func(o *Ops) error) error {
+	return std().WithSharedFileLock(path, fn)
+}
+
+// WithSharedFileLock is WithSharedFileLock using the settings of o.
+func (o *Ops) WithSharedFileLock(path string, fn func(o *Ops) error) error {
+	return o.withFileLock(path, true, fn)
+}
+
+// withFileLock implements WithFileLock and WithSharedFileLock.
+func (o *Ops) withFileLock(path string, shared bool, fn func(o *Ops) error) error {
+	target, err := o.resolve(path)
+	if err != nil {
+		return o.orExit(err)
+	}
+	key := lockKey(target)
+	if _, held := o.held[key]; held {
+		return fn(o)
+	}
+	lock, err := o.lockFile(target, shared)
+	if err != nil {
+		return o.orExit(err)
+	}
+	defer lock.release()
+	withFileLocks.add(key, lock)
+	defer withFileLocks.remove(key, lock)
+	c := *o
+	c.held = maps.Clone(o.held)
+	if c.held == nil {
+		c.held = map[string]*fileLock{}
+	}
+	c.held[key] = lock
+	return fn(&c)
+}
+
+// fileLock is an advisory lock on a file, also held on the files
+// replacing it while the lock is held.
+type fileLock struct {
+	mu     sync.Mutex
+	files  []*os.File
+	shared bool
+}
+
+// keep locks file f, which is about to replace the locked file, so
+// that the lock keeps covering the path after the rename. Returns
+// error on failure.
+func (l *fileLock) keep(f *os.File) error {
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("failed to lock %s: %w", f.Name(), err)
+	}
+	l.mu.Lock()
+	l.files = append(l.files, os.NewFile(uintptr(fd), f.Name()))
+	l.mu.Unlock()
+	return nil
+}
+
+// release releases the lock.
+func (l *fileLock) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, f := range l.files {
+		f.Close()
+	}
+	l.files = nil
+}
+
+// heldLocks are the locks held by WithFileLock in this process by
+// lock key.
+type heldLocks struct {
+	mu    sync.Mutex
+	locks map[string][]*fileLock
+}
+
+// withFileLocks are the locks held by WithFileLock in this process,
+// edits by any Ops not holding them would wait for them forever.
+var withFileLocks = &heldLocks{locks: map[string][]*fileLock{}}
+
+// add records lock on key as held.
+func (h *heldLocks) add(key string, lock *fileLock) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.locks[key] = append(h.locks[key], lock)
+}
+
+// remove records lock on key as released.
+func (h *heldLocks) remove(key string, lock *fileLock) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.locks[key] = slices.DeleteFunc(h.locks[key], func(l *fileLock) bool { return l == lock })
+	if len(h.locks[key]) == 0 {
+		delete(h.locks, key)
+	}
+}
+
+// conflicts reports whether a lock on key, shared or exclusive, would
+// have to wait for a lock held by WithFileLock.
+func (h *heldLocks) conflicts(key string, shared bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, l := range h.locks[key] {
+		if !shared || !l.shared {
+			return true
+		}
+	}
+	return false
+}
+
+// lockTarget locks filename for an edit by o, shared in dry-run mode,
+// unless o holds the lock through WithFileLock. Returns a copy of o
+// keeping the lock on files replacing filename and a function
+// releasing the lock, or error on failure, wrapping ErrLockHeld if
+// WithFileLock holds the lock for another Ops.
+func (o *Ops) lockTarget(filename string) (*Ops, func(), error) {
+	key := lockKey(filename)
+	lock, locked := o.held[key]
+	if locked && lock.shared && !o.DryRun {
+		return nil, nil, fmt.Errorf("can not modify %s holding a shared lock on it", filename)
+	}
+	release := func() {}
+	if !locked {
+		if withFileLocks.conflicts(key, o.DryRun) {
+			return nil, nil, fmt.Errorf("%s: %w, edit it using the Ops passed to fn", filename, ErrLockHeld)
+		}
+		var err error
+		if lock, err = o.lockFile(filename, o.DryRun); err != nil {
+			return nil, nil, err
+		}
+		release = lock.release
+	}
+	c := *o
+	c.lock = lock
+	return &c, release, nil
+}
+
+// lockFile acquires an advisory lock on filename, shared or
+// exclusive, waiting at most o.LockTimeout for it. If filename does
+// not exist, the nearest existing parent directory is locked instead.
+// If filename is replaced, created or removed while waiting, the lock
+// is retried on what filename is now. Returns the lock or error,
+// wrapping ErrLockTimeout on timeout.
+func (o *Ops) lockFile(filename string, shared bool) (*fileLock, error) {
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
+	var deadline time.Time
+	if o.LockTimeout > 0 {
+		deadline = time.Now().Add(o.LockTimeout)
+	}
+	for {
+		path, err := nearestExisting(filename)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := flock(f, how, deadline); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", filename, err)
+		}
+		locked, err := isLocked(filename, f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			return &fileLock{files: []*os.File{f}, shared: shared}, nil
+		}
+		// filename was replaced, created or removed while waiting
+		f.Close()
+	}
+}
+
+// flock locks f, waiting until deadline unless deadline is zero in
+// which case it waits forever. Returns ErrLockTimeout if deadline
+// passed.
+func flock(f *os.File, how int, deadline time.Time) error {
+	for {
+		flags := how
+		if !deadline.IsZero() {
+			flags |= syscall.LOCK_NB
+		}
+		err := syscall.Flock(int(f.Fd()), flags)
+		switch {
+		case err == syscall.EINTR:
+			continue
+		case err != syscall.EWOULDBLOCK:
+			return err
+		case time.Now().After(deadline):
+			return ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// isLocked reports whether locked file f is still what filename, or
+// the nearest existing parent directory of filename, refers to.
+func isLocked(filename string, f *os.File) (bool, error) {
+	path, err := nearestExisting(filename)
+	if err != nil {
+		return false, err
+	}
+	want, err := os.Stat(path)
+	if err != nil {
+		return false, nil
+	}
+	got, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(want, got), nil
+}
+
+// nearestExisting returns filename if it exists, otherwise its
+// nearest existing parent directory. Returns error on failure.
+func nearestExisting(filename string) (string, error) {
+	path := filename
+	for {
+		_, err := os.Stat(path)
+		if err == nil || !os.IsNotExist(err) || path == filepath.Dir(path) {
+			return path, err
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// lockKey returns the absolute path of filename with symlinks
+// resolved, identifying the lock on it.
+func lockKey(filename string) string {
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = resolved
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	return filename
+}
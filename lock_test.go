@@ -0,0 +1,183 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// lockedElsewhere reports whether path can not be locked exclusively
+// through a file description of its own.
+func lockedElsewhere(t *testing.T, path string) bool {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil && err != syscall.EWOULDBLOCK {
+		t.Fatal(err)
+	}
+	return err != nil
+}
+
+func TestFileLockTimeout(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "group")
+	if err := os.WriteFile(textfile, []byte("root:x:0:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Ops{LockTimeout: 50 * time.Millisecond}
+	if _, err := o.EnsureLineInFileWithOptions(textfile, "users:x:100:", LineOptions{}); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("Expected EnsureLineInFile to time out, got %v", err)
+	}
+	if _, err := o.PutFileWithOptions(textfile, "users:x:100:", FileOptions{}); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("Expected PutFile to time out, got %v", err)
+	}
+	dry := &Ops{DryRun: true, LockTimeout: 50 * time.Millisecond, Reporter: SilentReporter{}}
+	if _, err := dry.EnsureLineInFileWithOptions(textfile, "users:x:100:", LineOptions{}); err != nil {
+		t.Errorf("Expected a shared lock in dry-run mode, got %v", err)
+	}
+
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	if _, err := o.EnsureLineInFileWithOptions(textfile, "users:x:100:", LineOptions{}); err != nil {
+		t.Errorf("Expected lock once released, got %v", err)
+	}
+}
+
+func TestWithFileLock(t *testing.T) {
+	o := &Ops{LockTimeout: time.Second}
+	textfile := filepath.Join(t.TempDir(), "group")
+
+	err := o.WithFileLock(textfile, func(o *Ops) error {
+		// Nested edits reuse the lock, also on the created file
+		for _, line := range []string{"root:x:0:", "users:x:100:"} {
+			if _, err := o.EnsureLineInFileWithOptions(textfile, line, LineOptions{Create: true}); err != nil {
+				return err
+			}
+			if !lockedElsewhere(t, textfile) {
+				t.Error("Expected the replaced file to be locked")
+			}
+		}
+		return o.WithFileLock(textfile, func(*Ops) error { return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockedElsewhere(t, textfile) {
+		t.Error("Expected the lock to be released")
+	}
+
+	sentinel := errors.New("sentinel")
+	if err := o.WithSharedFileLock(textfile, func(*Ops) error { return sentinel }); err != sentinel {
+		t.Errorf("Expected the error of fn, got %v", err)
+	}
+	err = o.WithSharedFileLock(textfile, func(o *Ops) error {
+		_, err := o.EnsureLineInFileWithOptions(textfile, "wheel:x:10:", LineOptions{})
+		return err
+	})
+	if err == nil {
+		t.Error("Expected error modifying a file holding a shared lock")
+	}
+}
+
+func TestWithFileLockTopLevelEdit(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "group")
+	done := make(chan error, 1)
+	go func() {
+		done <- WithFileLock(textfile, func(*Ops) error {
+			_, err := EnsureLineInFileWithOptions(textfile, "root:x:0:", LineOptions{Create: true})
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrLockHeld) {
+			t.Errorf("Expected ErrLockHeld, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an edit using another Ops inside fn to fail, not wait for the lock")
+	}
+	// The lock is no longer held once fn returns
+	if _, err := EnsureLineInFileWithOptions(textfile, "root:x:0:", LineOptions{Create: true}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithFileLockExclusion(t *testing.T) {
+	o := &Ops{}
+	textfile := filepath.Join(t.TempDir(), "group")
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inside, overlaps := 0, 0
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := o.WithFileLock(textfile, func(*Ops) error {
+				mu.Lock()
+				inside++
+				if inside > 1 {
+					overlaps++
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				inside--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if overlaps != 0 {
+		t.Errorf("Expected one goroutine at a time holding the lock, got %d overlaps", overlaps)
+	}
+}
+
+func TestConcurrentLineEdits(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "group")
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := &Ops{}
+			_, err := o.EnsureLineInFileWithOptions(textfile, fmt.Sprintf("group%d:x:%d:", i, 1000+i), LineOptions{Create: true})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 20 {
+		t.Errorf("Expected 20 lines, got %d:\n%s", lines, content)
+	}
+}
@@ -0,0 +1,64 @@
+package fileops
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchMode decides how a pattern is matched against a line.
+type MatchMode int
+
+const (
+	// MatchPrefix matches lines starting with the pattern.
+	MatchPrefix MatchMode = iota
+	// MatchFull matches lines equal to the pattern.
+	MatchFull
+	// MatchContains matches lines containing the pattern.
+	MatchContains
+	// MatchRegexp matches lines matching the pattern as a regular
+	// expression (see regexp/syntax). Regular expressions are always
+	// matched against the line as is, leading and trailing spaces
+	// included.
+	MatchRegexp
+)
+
+// matcher reports whether line matches.
+type matcher func(line string) bool
+
+// newMatcher returns a matcher matching lines against pattern
+// according to mode. Leading and trailing spaces are trimmed from the
+// line before matching unless keepSpaces is true. Returns error if
+// pattern is not a valid regular expression in MatchRegexp mode.
+func newMatcher(pattern string, mode MatchMode, keepSpaces bool) (matcher, error) {
+	trim := func(line string) string {
+		if keepSpaces {
+			return line
+		}
+		return strings.TrimSpace(line)
+	}
+	switch mode {
+	case MatchPrefix:
+		return func(line string) bool { return strings.HasPrefix(trim(line), pattern) }, nil
+	case MatchFull:
+		return func(line string) bool { return trim(line) == pattern }, nil
+	case MatchContains:
+		return func(line string) bool { return strings.Contains(trim(line), pattern) }, nil
+	case MatchRegexp:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("unknown match mode %d", mode)
+}
+
+// matchMode translates the matchFullStringNotJustPrefix flag used
+// throughout the package into a MatchMode.
+func matchMode(matchFullStringNotJustPrefix bool) MatchMode {
+	if matchFullStringNotJustPrefix {
+		return MatchFull
+	}
+	return MatchPrefix
+}
@@ -1,15 +1,120 @@
 package fileops
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
 
 // MkdirAll creates path directory including all parent directories
 // (similar to mkdir -p). If a sub directory does not exist, it will
 // be created with mode 0755 by default or the value of the first item
 // in the optional perm slice. Returns error on failure.
 func MkdirAll(path string, perm ...os.FileMode) error {
+	return std().MkdirAll(path, perm...)
+}
+
+// MkdirAll is MkdirAll using the settings of o.
+func (o *Ops) MkdirAll(path string, perm ...os.FileMode) error {
 	var permission os.FileMode = 0755
 	if len(perm) > 0 {
 		permission = perm[0]
 	}
-	return orExit(os.MkdirAll(path, permission))
+	target, err := o.resolve(path)
+	if err != nil {
+		return o.orExit(err)
+	}
+	for _, dir := range missingDirs(target) {
+		if err := o.touch(dir); err != nil {
+			return o.orExit(err)
+		}
+	}
+	return o.orExit(os.MkdirAll(target, permission))
+}
+
+// MkdirAllWithOptions creates path directory including all parent
+// directories like MkdirAll. Missing directories are created with
+// mode opts.DirMode (0755 if 0). If opts.Owner and/or opts.Group are
+// not empty, they are set on path and on every directory created.
+// Other FileOptions are ignored. Returns a Result describing the
+// change or error on failure.
+func MkdirAllWithOptions(path string, opts FileOptions) (Result, error) {
+	return std().MkdirAllWithOptions(path, opts)
+}
+
+// MkdirAllWithOptions is MkdirAllWithOptions using the settings of o.
+func (o *Ops) MkdirAllWithOptions(path string, opts FileOptions) (result Result, err error) {
+	defer func() { o.logResult(result, err) }()
+	o.reportCall("MkdirAllWithOptions(%q, %+v)", path, opts)
+	result = Result{Action: ActionNone, Path: path}
+	target, err := o.resolve(path)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+	created, err := o.mkdirAll(target, opts.dirMode(), opts.Owner, opts.Group)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+	changed, err := o.ensureOwnership(target, opts.Owner, opts.Group)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+	switch {
+	case created:
+		result.Changed = true
+		result.Action = ActionCreated
+	case changed:
+		result.Changed = true
+		result.Action = ActionUpdated
+	}
+	return result, nil
+}
+
+// mkdirAll creates directory target (already resolved under Root)
+// including missing parents with mode perm and sets owner and group
+// (unless empty) of every directory created. In dry-run mode the
+// calls are only printed. Returns true if any directory was (or would
+// have been) created, error on failure.
+func (o *Ops) mkdirAll(target string, perm os.FileMode, owner, group string) (bool, error) {
+	missing := missingDirs(target)
+	if len(missing) == 0 {
+		return false, nil
+	}
+	for _, dir := range missing {
+		if err := o.touch(dir); err != nil {
+			return false, err
+		}
+	}
+	if !o.DryRun {
+		if err := os.MkdirAll(target, perm); err != nil {
+			return false, fmt.Errorf("failed to create directories: %w", err)
+		}
+	}
+	o.report(Event{Kind: EventDirCreated, Path: target, Action: ActionCreated, Message: fmt.Sprintf("os.MkdirAll(%q, %v)", target, perm)})
+	for _, dir := range missing {
+		if _, err := o.ensureOwnership(dir, owner, group); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// missingDirs returns dir and those of its parent directories that do
+// not exist, outermost first.
+func missingDirs(dir string) []string {
+	var missing []string
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	slices.Reverse(missing)
+	return missing
 }
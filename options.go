@@ -0,0 +1,243 @@
+package fileops
+
+import "os"
+
+// LineOptions configures EnsureLineInFileWithOptions,
+// RemoveLineFromFileWithOptions, ReplaceLineInFileWithOptions,
+// CommentLineInFile and UncommentLineInFile. The
+// zero value matches lines by prefix after trimming leading and
+// trailing spaces, has no anchors, affects all matching lines and
+// does not create missing files.
+type LineOptions struct {
+	// Match decides how the line (or Existing) pattern is matched
+	// against lines in the file. In MatchRegexp mode, the
+	// replacement line of ReplaceLineInFileWithOptions may refer to
+	// capture groups using $1, ${1} or ${name}.
+	Match MatchMode
+	// KeepSpaces matches lines including leading and trailing spaces
+	// instead of trimming them first. Does not apply to MatchRegexp.
+	KeepSpaces bool
+	// Existing is the pattern locating the existing line to be
+	// replaced by EnsureLineInFileWithOptions, which removes any
+	// other lines it matches. Defaults to the line itself if empty.
+	Existing string
+	// Before and After are anchors, matched according to
+	// AnchorMatch, unless empty. EnsureLineInFileWithOptions inserts
+	// the line after the first line matching After and/or before the
+	// first line matching Before. RemoveLineFromFileWithOptions only
+	// removes lines preceded by a line matching Before and/or
+	// followed by a line matching After.
+	Before, After string
+	// AnchorMatch decides how Before and After are matched.
+	AnchorMatch MatchMode
+	// Count is the maximum number of lines removed or replaced, 0 (or
+	// negative) affects all matching lines.
+	Count int
+	// FileMode is the mode of a file created by
+	// EnsureLineInFileWithOptions, 0644 if 0. The mode of an existing
+	// file is preserved.
+	FileMode os.FileMode
+	// Owner and Group, unless empty, are names or numeric ids set as
+	// owner and group of the file whenever it is modified or created.
+	Owner, Group string
+	// Backup, unless BackupNone, overrides the backup policy of the
+	// Ops (see Ops.Backup) for this call.
+	Backup BackupPolicy
+	// Create creates the file if it does not exist. If false, a
+	// missing file is an error.
+	Create bool
+	// Validate and ValidateFunc validate the edited file before it
+	// replaces the original, see FileOptions.
+	Validate     string
+	ValidateFunc func(path string) error
+	// Normalize rewrites the file with LF line endings, without a
+	// UTF-8 BOM and with a final newline. By default, the line
+	// endings (the most common if mixed), BOM and final newline state
+	// of an existing file are preserved.
+	Normalize bool
+	// Comment is the prefix of commented-out lines, "#" if empty, see
+	// CommentLineInFile and ReplaceCommented.
+	Comment string
+	// ReplaceCommented makes EnsureLineInFileWithOptions replace the
+	// first line matching Existing (or the line) in place, or if none
+	// matches, the first commented-out line matching once
+	// uncommented, regardless of Before and After. For example, with
+	// Existing set to "PermitRootLogin ", "PermitRootLogin no"
+	// replaces "#PermitRootLogin yes" where it is.
+	ReplaceCommented bool
+
+	// hasBefore and hasAfter make empty Before and After anchors
+	// count, as nil and empty anchors differ in the positional API,
+	// see flagOptions.
+	hasBefore, hasAfter bool
+}
+
+// FileOptions configures PutFileWithOptions, PutFileFromFSWithOptions
+// and MkdirAllWithOptions. The zero value writes files with mode 0644,
+// creating missing directories with mode 0755.
+type FileOptions struct {
+	// FileMode is the mode of the file, 0644 if 0.
+	FileMode os.FileMode
+	// DirMode is the mode of missing parent directories created, 0755
+	// if 0.
+	DirMode os.FileMode
+	// Owner and Group, unless empty, are names or numeric ids set as
+	// owner and group of the file and of missing parent directories
+	// created.
+	Owner, Group string
+	// Backup, unless BackupNone, overrides the backup policy of the
+	// Ops (see Ops.Backup) for this call.
+	Backup BackupPolicy
+	// IfNotExists leaves an existing file untouched, only missing
+	// files are created.
+	IfNotExists bool
+	// Validate, unless empty, is a command run using /bin/sh -c to
+	// validate the new content, written to a temporary file, before
+	// it replaces the file. %s in Validate is replaced by the quoted
+	// path of the temporary file, e.g "visudo -cf %s". If the command
+	// fails, the file is left untouched and the error includes the
+	// output of the command. Validation is skipped in dry-run mode.
+	Validate string
+	// ValidateFunc, unless nil, is called with the path of the
+	// temporary file like Validate, an error leaves the file
+	// untouched.
+	ValidateFunc func(path string) error
+}
+
+// fileMode returns FileMode or the default 0644.
+func (opts LineOptions) fileMode() os.FileMode {
+	if opts.FileMode == 0 {
+		return 0644
+	}
+	return opts.FileMode
+}
+
+// fileMode returns FileMode or the default 0644.
+func (opts FileOptions) fileMode() os.FileMode {
+	if opts.FileMode == 0 {
+		return 0644
+	}
+	return opts.FileMode
+}
+
+// dirMode returns DirMode or the default 0755.
+func (opts FileOptions) dirMode() os.FileMode {
+	if opts.DirMode == 0 {
+		return 0755
+	}
+	return opts.DirMode
+}
+
+// count returns Count as used by removeLines and replaceLines where -1
+// means all lines.
+func (opts LineOptions) count() int {
+	if opts.Count <= 0 {
+		return -1
+	}
+	return opts.Count
+}
+
+// comment returns Comment or the default "#".
+func (opts LineOptions) comment() string {
+	if opts.Comment == "" {
+		return "#"
+	}
+	return opts.Comment
+}
+
+// matchers returns matchers for pattern and the Before and After
+// anchors (nil if not set). Returns error if a regular expression is
+// invalid.
+func (opts LineOptions) matchers(pattern string) (match, before, after matcher, err error) {
+	if match, err = newMatcher(pattern, opts.Match, opts.KeepSpaces); err != nil {
+		return
+	}
+	if opts.Before != "" || opts.hasBefore {
+		if before, err = newMatcher(opts.Before, opts.AnchorMatch, opts.KeepSpaces); err != nil {
+			return
+		}
+	}
+	if opts.After != "" || opts.hasAfter {
+		after, err = newMatcher(opts.After, opts.AnchorMatch, opts.KeepSpaces)
+	}
+	return
+}
+
+// withBackup returns o or, if policy is not BackupNone, a copy of o
+// using backup policy policy.
+func (o *Ops) withBackup(policy BackupPolicy) *Ops {
+	if policy == BackupNone {
+		return o
+	}
+	c := *o
+	c.Backup = policy
+	return &c
+}
+
+// withValidator returns o or, if validate is not nil, a copy of o
+// validating files with validate before replacing them.
+func (o *Ops) withValidator(validate func(path string) error) *Ops {
+	if validate == nil {
+		return o
+	}
+	c := *o
+	c.validate = validate
+	return &c
+}
+
+// validator returns the validator of Validate and ValidateFunc.
+func (opts LineOptions) validator() func(path string) error {
+	return newValidator(opts.Validate, opts.ValidateFunc)
+}
+
+// validator returns the validator of Validate and ValidateFunc.
+func (opts FileOptions) validator() func(path string) error {
+	return newValidator(opts.Validate, opts.ValidateFunc)
+}
+
+// existing returns the Existing pattern or line if empty.
+func (opts LineOptions) existing(line string) string {
+	if opts.Existing == "" {
+		return line
+	}
+	return opts.Existing
+}
+
+// flagOptions translates the before/after pointers and boolean flags
+// of the positional API into LineOptions.
+func flagOptions(before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) LineOptions {
+	mode := matchMode(matchFullStringNotJustPrefix)
+	return LineOptions{
+		Match:       mode,
+		KeepSpaces:  matchWithLeadingAndTrailingSpaces,
+		Before:      deref(before),
+		After:       deref(after),
+		AnchorMatch: mode,
+		hasBefore:   before != nil,
+		hasAfter:    after != nil,
+	}
+}
+
+// regexpOptions returns LineOptions matching lines using regular
+// expression pattern and the optional before and after regular
+// expressions.
+func regexpOptions(pattern string, before, after *string) LineOptions {
+	return LineOptions{
+		Match:       MatchRegexp,
+		Existing:    pattern,
+		Before:      deref(before),
+		After:       deref(after),
+		AnchorMatch: MatchRegexp,
+		hasBefore:   before != nil,
+		hasAfter:    after != nil,
+	}
+}
+
+// deref returns the string s points to or an empty string if s is
+// nil.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
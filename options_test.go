@@ -0,0 +1,87 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLineOptions(t *testing.T) {
+	o := &Ops{}
+	testLineEdits(t, []lineEditTest{
+		{"anchor", []string{"#Port 22"}, func(textfile string) (Result, error) {
+			return o.EnsureLineInFileWithOptions(textfile, "PermitRootLogin no", LineOptions{Before: `^#Port`, AnchorMatch: MatchRegexp})
+		}, ActionInserted, []string{"PermitRootLogin no", "#Port 22"}},
+		{"regexp replace", []string{"PermitRootLogin no", "#Port 22"}, func(textfile string) (Result, error) {
+			return o.ReplaceLineInFileWithOptions(textfile, `^#\s*Port\s+(\d+)$`, "Port $1", LineOptions{Match: MatchRegexp})
+		}, ActionReplaced, []string{"PermitRootLogin no", "Port 22"}},
+		{"existing", []string{"PermitRootLogin no", "Port 22"}, func(textfile string) (Result, error) {
+			return o.EnsureLineInFileWithOptions(textfile, "PermitRootLogin prohibit-password", LineOptions{Existing: "PermitRootLogin ", After: "Port"})
+		}, ActionReplaced, []string{"Port 22", "PermitRootLogin prohibit-password"}},
+		{"remove none", []string{"Port 22"}, func(textfile string) (Result, error) {
+			return o.RemoveLineFromFileWithOptions(textfile, "Port", LineOptions{Match: MatchFull})
+		}, ActionNone, []string{"Port 22"}},
+		{"remove count", []string{"Port 22", "Port 22"}, func(textfile string) (Result, error) {
+			return o.RemoveLineFromFileWithOptions(textfile, "Port 22", LineOptions{Match: MatchFull, Count: 1})
+		}, ActionRemoved, []string{"Port 22"}},
+	})
+}
+
+func TestLineOptionsCreate(t *testing.T) {
+	o := &Ops{}
+	textfile := filepath.Join(t.TempDir(), "sshd_config")
+	if _, err := o.EnsureLineInFileWithOptions(textfile, "Port 22", LineOptions{}); !os.IsNotExist(err) {
+		t.Fatalf("Expected not exist error without Create, got %v", err)
+	}
+	result, err := o.EnsureLineInFileWithOptions(textfile, "Port 22", LineOptions{Create: true, FileMode: 0600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionInserted {
+		t.Errorf("Expected action %s, got %s", ActionInserted, result.Action)
+	}
+	if content, err := os.ReadFile(textfile); err != nil || string(content) != "Port 22\n" {
+		t.Errorf("Expected content %q, got %q (%v)", "Port 22\n", content, err)
+	}
+	info, err := os.Stat(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := os.FileMode(0600), info.Mode().Perm(); expected != got {
+		t.Errorf("Expected mode %v, got %v", expected, got)
+	}
+}
+
+func TestFileOptions(t *testing.T) {
+	o := &Ops{}
+	textfile := filepath.Join(t.TempDir(), "sub", "dir", "file")
+	owner := strconv.Itoa(os.Getuid())
+	group := strconv.Itoa(os.Getgid())
+
+	result, err := o.PutFileWithOptions(textfile, "first", FileOptions{DirMode: 0700, Owner: owner, Group: group, Backup: BackupNumbered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionCreated {
+		t.Errorf("Expected action %s, got %s", ActionCreated, result.Action)
+	}
+	if info, err := os.Stat(filepath.Dir(textfile)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected directory mode 0700, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	result, err = o.PutFileWithOptions(textfile, "second", FileOptions{IfNotExists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Changed {
+		t.Errorf("Expected existing file to be left untouched, got %s", result)
+	}
+
+	if _, err := o.PutFileWithOptions(textfile, "third", FileOptions{Backup: BackupNumbered}); err != nil {
+		t.Fatal(err)
+	}
+	if !Exists(textfile + ".~1~") {
+		t.Error("Expected a numbered backup")
+	}
+}
@@ -0,0 +1,134 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// stderrTailLines is the number of trailing lines of standard error
+// included in the error of a failing command, see Output.
+const stderrTailLines = 10
+
+// CommandOutput is the captured output of a command run by Output or
+// CombinedOutput.
+type CommandOutput struct {
+	Result
+	// Stdout and Stderr are the standard output and error of the
+	// command. For CombinedOutput, both are captured in Stdout.
+	Stdout, Stderr []byte
+	// ExitCode is the exit code of the command, -1 if it could not
+	// be run or was killed.
+	ExitCode int
+}
+
+// OutputOptions configures Output and CombinedOutput.
+type OutputOptions struct {
+	RunOptions
+	// Tee also writes the output of the command to Ops.Stdout and
+	// Ops.Stderr (os.Stdout and os.Stderr by default) as it is
+	// captured. The combined output of CombinedOutput is written to
+	// Ops.Stdout only.
+	Tee bool
+	// DryRunOutput is returned instead of running the command in
+	// dry-run mode, with Result filled in.
+	DryRunOutput CommandOutput
+}
+
+// Output runs command like Run, but captures its standard output
+// and error. Returns the output and exit code of the command, and
+// error if the command could not be run or exited non-zero, in which
+// case the error includes the last lines of standard error.
+func Output(command string, opts OutputOptions) (CommandOutput, error) {
+	return std().Output(command, opts)
+}
+
+// Output is Output using the settings of o.
+func (o *Ops) Output(command string, opts OutputOptions) (CommandOutput, error) {
+	return o.OutputContext(context.Background(), command, opts)
+}
+
+// OutputContext is Output killing the command if ctx is done, see
+// RunContext.
+func OutputContext(ctx context.Context, command string, opts OutputOptions) (CommandOutput, error) {
+	return std().OutputContext(ctx, command, opts)
+}
+
+// OutputContext is OutputContext using the settings of o.
+func (o *Ops) OutputContext(ctx context.Context, command string, opts OutputOptions) (CommandOutput, error) {
+	return o.output(ctx, command, opts, false)
+}
+
+// CombinedOutput is Output capturing standard output and error
+// together in CommandOutput.Stdout, in the order the command wrote
+// them.
+func CombinedOutput(command string, opts OutputOptions) (CommandOutput, error) {
+	return std().CombinedOutput(command, opts)
+}
+
+// CombinedOutput is CombinedOutput using the settings of o.
+func (o *Ops) CombinedOutput(command string, opts OutputOptions) (CommandOutput, error) {
+	return o.CombinedOutputContext(context.Background(), command, opts)
+}
+
+// CombinedOutputContext is CombinedOutput killing the command if ctx
+// is done, see RunContext.
+func CombinedOutputContext(ctx context.Context, command string, opts OutputOptions) (CommandOutput, error) {
+	return std().CombinedOutputContext(ctx, command, opts)
+}
+
+// CombinedOutputContext is CombinedOutputContext using the settings of o.
+func (o *Ops) CombinedOutputContext(ctx context.Context, command string, opts OutputOptions) (CommandOutput, error) {
+	return o.output(ctx, command, opts, true)
+}
+
+// output implements OutputContext and, if combined,
+// CombinedOutputContext.
+func (o *Ops) output(ctx context.Context, command string, opts OutputOptions, combined bool) (out CommandOutput, err error) {
+	defer func() { o.logResult(out.Result, err) }()
+	result := Result{Changed: true, Action: ActionRun, Command: command}
+	shell := `/bin/sh`
+	shellCommandOption := `-c`
+
+	o.report(Event{Kind: EventCommandRun, Command: command, Action: ActionRun, Message: fmt.Sprintf("RUN %q", command)})
+
+	if o.DryRun {
+		o.reportCall("exec.Command(%q, %q, %q)", shell, shellCommandOption, command)
+		out = opts.DryRunOutput
+		out.Result = result
+		return out, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	var stdoutW, stderrW io.Writer = &stdout, &stderr
+	if opts.Tee {
+		stdoutW = io.MultiWriter(stdoutW, o.stdout())
+		stderrW = io.MultiWriter(stderrW, o.stderr())
+	}
+	if combined {
+		// The same writer makes exec use a single pipe, keeping the
+		// order in which output and error were written.
+		stderrW = stdoutW
+	}
+	out.ExitCode, err = o.runCommand(ctx, shell, []string{shellCommandOption, command}, opts.RunOptions, stdoutW, stderrW)
+	out.Result, out.Stdout, out.Stderr = result, stdout.Bytes(), stderr.Bytes()
+	if err != nil {
+		captured := out.Stderr
+		if combined {
+			captured = out.Stdout
+		}
+		if tail := tailLines(captured, stderrTailLines); tail != "" {
+			err = fmt.Errorf("%w: %s", err, tail)
+		}
+	}
+	return out, o.orExit(err)
+}
+
+// tailLines returns the last n lines of output, trimmed of
+// surrounding white space.
+func tailLines(output []byte, n int) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.Join(lines[max(len(lines)-n, 0):], "\n")
+}
@@ -0,0 +1,57 @@
+package fileops
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	o := &Ops{Stdout: &stdout, Stderr: &stderr, Reporter: SilentReporter{}}
+
+	out, err := o.Output("echo out; echo err >&2; exit 3", OutputOptions{})
+	if err == nil || !strings.HasSuffix(err.Error(), "exit status 3: err") {
+		t.Errorf("Expected error with stderr, got %v", err)
+	}
+	if string(out.Stdout) != "out\n" || string(out.Stderr) != "err\n" || out.ExitCode != 3 {
+		t.Errorf("Unexpected output %q and %q, exit code %d", out.Stdout, out.Stderr, out.ExitCode)
+	}
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("Expected nothing written without Tee, got %q and %q", stdout.String(), stderr.String())
+	}
+
+	_, err = o.Output("seq 1 20 | sed 's/^/line /' >&2; false", OutputOptions{})
+	if err == nil || !strings.HasSuffix(err.Error(), ": line 11\nline 12\nline 13\nline 14\nline 15\nline 16\nline 17\nline 18\nline 19\nline 20") {
+		t.Errorf("Expected error with the last 10 lines of stderr, got %v", err)
+	}
+
+	for _, tee := range []bool{false, true} {
+		out, err = o.CombinedOutput("for i in 1 2 3 4 5; do echo out$i; echo err$i >&2; done", OutputOptions{Tee: tee})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "out1\nerr1\nout2\nerr2\nout3\nerr3\nout4\nerr4\nout5\nerr5\n"; string(out.Stdout) != expected || out.ExitCode != 0 {
+			t.Errorf("Unexpected combined output %q with tee %t, exit code %d", out.Stdout, tee, out.ExitCode)
+		}
+	}
+	if stdout.String() != string(out.Stdout) || stderr.Len() != 0 {
+		t.Errorf("Expected combined output tee'd to stdout, got %q and %q", stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	if _, err := o.Output("echo out; echo err >&2", OutputOptions{Tee: true}); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("Expected output tee'd, got %q and %q", stdout.String(), stderr.String())
+	}
+
+	dry := &Ops{DryRun: true, Reporter: SilentReporter{}}
+	out, err = dry.Output("systemctl is-active nginx", OutputOptions{DryRunOutput: CommandOutput{Stdout: []byte("active\n")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Stdout) != "active\n" || out.Command != "systemctl is-active nginx" || out.Action != ActionRun {
+		t.Errorf("Expected canned dry-run output, got %q, %s", out.Stdout, out.Result)
+	}
+}
@@ -0,0 +1,97 @@
+package fileops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ensureOwnership changes owner and/or group of target (already
+// resolved under Root), or of the file it points to if it is a
+// symlink, unless they are empty or already set. owner and group are
+// names or numeric ids. In dry-run mode the change is only printed.
+// Returns true if ownership was (or would have been) changed, error
+// on failure.
+func (o *Ops) ensureOwnership(target, owner, group string) (bool, error) {
+	if owner == "" && group == "" {
+		return false, nil
+	}
+	uid, gid, err := o.lookupIDs(owner, group)
+	if err != nil {
+		return false, err
+	}
+	// Change the file a symlink points to, not the symlink itself
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	info, err := os.Lstat(target)
+	if err != nil {
+		if o.DryRun && os.IsNotExist(err) {
+			o.reportOwnership(target, uid, gid)
+			return true, nil
+		}
+		return false, err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if (uid == -1 || uint32(uid) == st.Uid) && (gid == -1 || uint32(gid) == st.Gid) {
+			return false, nil
+		}
+	}
+	if err := o.touch(target); err != nil {
+		return false, err
+	}
+	if !o.DryRun {
+		if err := os.Lchown(target, uid, gid); err != nil {
+			return false, err
+		}
+	}
+	o.reportOwnership(target, uid, gid)
+	return true, nil
+}
+
+// reportOwnership reports an ownership change of target.
+func (o *Ops) reportOwnership(target string, uid, gid int) {
+	o.report(Event{Kind: EventOwnershipChanged, Path: target, Action: ActionUpdated, Message: fmt.Sprintf("os.Lchown(%q, %d, %d)", target, uid, gid)})
+}
+
+// Chown changes owner and/or group of path unless they are empty or
+// already set. owner and group are user and group names or numeric
+// ids, resolved like UserExists and HomeDir resolve users. If path is
+// a symlink, the file it points to is changed. Returns error on
+// failure.
+func Chown(path, owner, group string) error {
+	return std().Chown(path, owner, group)
+}
+
+// Chown is Chown using the settings of o.
+func (o *Ops) Chown(path, owner, group string) error {
+	_, err := o.EnsureOwnership(path, owner, group)
+	return err
+}
+
+// EnsureOwnership is Chown returning a Result describing whether
+// ownership of path was changed. Returns error on failure.
+func EnsureOwnership(path, owner, group string) (Result, error) {
+	return std().EnsureOwnership(path, owner, group)
+}
+
+// EnsureOwnership is EnsureOwnership using the settings of o.
+func (o *Ops) EnsureOwnership(path, owner, group string) (result Result, err error) {
+	defer func() { o.logResult(result, err) }()
+	o.reportCall("EnsureOwnership(%q, %q, %q)", path, owner, group)
+	result = Result{Action: ActionNone, Path: path}
+	target, err := o.resolve(path)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+	changed, err := o.ensureOwnership(target, owner, group)
+	if err != nil {
+		return result, o.orExit(err)
+	}
+	if changed {
+		result.Changed = true
+		result.Action = ActionUpdated
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package fileops
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEnsureOwnership(t *testing.T) {
+	root := t.TempDir()
+	o := &Ops{Root: root}
+	if err := o.PutFile("/etc/passwd", "root:x:0:0:root:/root:/bin/sh\nalice:x:12345:12345::/home/alice:/bin/bash", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.PutFile("/etc/group", "root:x:0:\nstaff:x:12346:alice", 0644); err != nil {
+		t.Fatal(err)
+	}
+	uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+
+	result, err := o.MkdirAllWithOptions("/home/alice/.ssh", FileOptions{DirMode: 0700, Owner: uid, Group: gid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionCreated {
+		t.Errorf("Expected directory to be created, got %s", result)
+	}
+	if result, err = o.MkdirAllWithOptions("/home/alice/.ssh", FileOptions{Owner: uid}); err != nil || result.Changed {
+		t.Errorf("Expected no change, got %s, %v", result, err)
+	}
+	if result, err = o.EnsureOwnership("/home/alice/.ssh", uid, gid); err != nil || result.Changed {
+		t.Errorf("Expected no change, got %s, %v", result, err)
+	}
+
+	var stderr bytes.Buffer
+	dry := &Ops{DryRun: true, Root: root, Stderr: &stderr}
+	if result, err = dry.EnsureOwnership("/home/alice/.ssh", "alice", "staff"); err != nil || result.Action != ActionUpdated {
+		t.Errorf("Expected ownership update, got %s, %v", result, err)
+	}
+	if expected := "12345, 12346)"; !strings.Contains(stderr.String(), expected) {
+		t.Errorf("Expected %q in dry-run output, got %q", expected, stderr.String())
+	}
+	if err := dry.Chown("/home/alice/.ssh", "bob", ""); err == nil {
+		t.Error("Expected error for unknown user")
+	}
+
+	if os.Geteuid() != 0 {
+		t.Skip("Changing ownership requires root")
+	}
+	fsys := fstest.MapFS{"keys/authorized_keys": {Data: []byte("ssh-ed25519 AAAA alice\n")}}
+	results, err := o.PutFileFromFSWithOptions(fsys, "keys", "/home/alice/.ssh", FileOptions{FileMode: 0600, Owner: "alice", Group: "staff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Action != ActionCreated {
+		t.Errorf("Expected one file created, got %v", results)
+	}
+	for _, p := range []string{".ssh", ".ssh/authorized_keys"} {
+		info, err := os.Stat(filepath.Join(root, "home", "alice", p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		if st.Uid != 12345 || st.Gid != 12346 {
+			t.Errorf("Expected %s owned by 12345:12346, got %d:%d", p, st.Uid, st.Gid)
+		}
+	}
+}
+
+func TestEnsureOwnershipSymlink(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Changing ownership requires root")
+	}
+	dir := t.TempDir()
+	textfile, link := filepath.Join(dir, "hosts"), filepath.Join(dir, "link")
+	if err := os.WriteFile(textfile, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("hosts", link); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Ops{}
+	opts := FileOptions{Owner: "65534", Group: "65534"}
+	if result, err := o.PutFileWithOptions(link, "10.0.0.1 gateway", opts); err != nil || result.Action != ActionUpdated {
+		t.Fatalf("Expected file to be updated, got %s, %v", result, err)
+	}
+	info, err := os.Stat(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := info.Sys().(*syscall.Stat_t); st.Uid != 65534 || st.Gid != 65534 {
+		t.Errorf("Expected the file behind the symlink owned by 65534:65534, got %d:%d", st.Uid, st.Gid)
+	}
+	if result, err := o.PutFileWithOptions(link, "10.0.0.1 gateway", opts); err != nil || result.Changed {
+		t.Errorf("Expected no change, got %s, %v", result, err)
+	}
+	if result, err := o.EnsureOwnership(link, "0", "0"); err != nil || result.Action != ActionUpdated {
+		t.Errorf("Expected ownership update, got %s, %v", result, err)
+	}
+}
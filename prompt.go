@@ -3,7 +3,6 @@ package fileops
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"time"
 )
 
@@ -11,13 +10,18 @@ import (
 // return/enter is pressed if seconds is less than 0 (e.g -1). 0
 // seconds returns immediately.
 func Wait(seconds int) {
+	std().Wait(seconds)
+}
+
+// Wait is Wait using the settings of o.
+func (o *Ops) Wait(seconds int) {
 	if seconds == 0 {
 		return
 	} else if seconds <= 0 {
-		fmt.Println("Press 'Enter' to continue.,,")
-		bufio.NewReader(os.Stdin).ReadBytes('\n')
+		fmt.Fprintln(o.stdout(), "Press 'Enter' to continue.,,")
+		bufio.NewReader(o.stdin()).ReadBytes('\n')
 		return
 	}
-	fmt.Printf("Waiting %d seconds...\n", seconds)
+	fmt.Fprintf(o.stdout(), "Waiting %d seconds...\n", seconds)
 	time.Sleep(time.Second * time.Duration(seconds))
 }
@@ -2,7 +2,6 @@ package fileops
 
 import (
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -14,14 +13,66 @@ import (
 // created using optional dirPerm or mode 0755 by default. Returns
 // error if something failed.
 func PutFile(destination, content string, filePerm os.FileMode, dirPerm ...os.FileMode) error {
-	// Determine directory permissions
-	var directoryPermission os.FileMode = 0755
+	return std().PutFile(destination, content, filePerm, dirPerm...)
+}
+
+// PutFile is PutFile using the settings of o.
+func (o *Ops) PutFile(destination, content string, filePerm os.FileMode, dirPerm ...os.FileMode) error {
+	_, err := o.PutFileWithResult(destination, content, filePerm, dirPerm...)
+	return err
+}
+
+// PutFileWithResult is PutFile returning a Result describing whether
+// destination was created or had its content or mode updated.
+// Returns error if something failed.
+func PutFileWithResult(destination, content string, filePerm os.FileMode, dirPerm ...os.FileMode) (Result, error) {
+	return std().PutFileWithResult(destination, content, filePerm, dirPerm...)
+}
+
+// PutFileWithResult is PutFileWithResult using the settings of o.
+func (o *Ops) PutFileWithResult(destination, content string, filePerm os.FileMode, dirPerm ...os.FileMode) (Result, error) {
+	opts := FileOptions{FileMode: filePerm}
 	if len(dirPerm) > 0 {
-		directoryPermission = dirPerm[0]
+		opts.DirMode = dirPerm[0]
+	}
+	result, err := o.putFile(destination, content, opts)
+	return result, o.orExit(err)
+}
+
+// PutFileWithOptions writes content into local file destination like
+// PutFile, but configured by opts, see FileOptions. Returns a Result
+// describing the change or error if something failed.
+func PutFileWithOptions(destination, content string, opts FileOptions) (Result, error) {
+	return std().PutFileWithOptions(destination, content, opts)
+}
+
+// PutFileWithOptions is PutFileWithOptions using the settings of o.
+func (o *Ops) PutFileWithOptions(destination, content string, opts FileOptions) (Result, error) {
+	o.reportCall("PutFileWithOptions(%q, <content>, %+v)", destination, opts)
+	result, err := o.putFile(destination, content, opts)
+	return result, o.orExit(err)
+}
+
+// putFile implements PutFileWithOptions without dry-run printing the
+// call.
+func (o *Ops) putFile(destination, content string, opts FileOptions) (result Result, err error) {
+	defer func() { o.logResult(result, err) }()
+	result = Result{Action: ActionNone, Path: destination}
+	target, err := o.resolve(destination)
+	if err != nil {
+		return result, err
+	}
+	locked, unlock, err := o.lockTarget(target)
+	if err != nil {
+		return result, err
 	}
+	defer unlock()
+
+	filePerm := opts.fileMode()
+	directoryPermission := opts.dirMode()
 
 	// Get the directory path from the destination
-	dirPath := filepath.Dir(destination)
+	dirPath := filepath.Dir(target)
 
 	// Make sure content ends with a new line
 	newline := "\n"
@@ -33,41 +84,77 @@ func PutFile(destination, content string, filePerm os.FileMode, dirPerm ...os.Fi
 		content += newline
 	}
 
-	if DryRun {
-		fmt.Fprintf(os.Stderr, "os.MkdirAll(%q, %v)\n", dirPath, directoryPermission)
-	} else {
-		// Create directories if they do not exist
-		err := os.MkdirAll(dirPath, directoryPermission)
+	// Compare with the current destination, if any
+	var existingContent string
+	existing, err := os.Stat(target)
+	switch {
+	case err == nil && opts.IfNotExists:
+		return result, nil
+	case err == nil:
+		b, err := os.ReadFile(target)
 		if err != nil {
-			return orExit(fmt.Errorf("failed to create directories: %w", err))
+			return result, fmt.Errorf("failed to read existing file: %w", err)
 		}
+		existingContent = string(b)
+		result.BeforeHash = hashContent(b)
+	case !os.IsNotExist(err):
+		return result, err
+	}
+	result.AfterHash = hashContent([]byte(content))
+	switch {
+	case existing == nil:
+		result.Changed = true
+		result.Action = ActionCreated
+	case result.BeforeHash != result.AfterHash || existing.Mode().Perm() != filePerm.Perm():
+		result.Changed = true
+		result.Action = ActionUpdated
+	}
+	result.Diff = o.fileDiff(destination, []byte(existingContent), []byte(content), existing != nil)
+
+	// Create directories if they do not exist
+	if _, err := o.mkdirAll(dirPath, directoryPermission, opts.Owner, opts.Group); err != nil {
+		return result, err
 	}
 
-	if DryRun {
-		fmt.Fprintf(os.Stderr, "os.WriteFile(%q, %q, %v)\n", destination, content, filePerm)
+	if existing != nil && result.BeforeHash == result.AfterHash {
+		// Leave identical content untouched, only fix the mode
+		if err := o.ensureMode(target, existing, filePerm); err != nil {
+			return result, err
+		}
 	} else {
-		// Write the file
-		if err := os.WriteFile(destination, []byte(content), filePerm); err != nil {
-			return orExit(fmt.Errorf("failed to write file: %w", err))
+		// Atomically write the file
+		if !o.DryRun {
+			if err := locked.withBackup(opts.Backup).withValidator(opts.validator()).writeFileAtomic(target, strings.NewReader(content), filePerm, true); err != nil {
+				return result, fmt.Errorf("failed to write file: %w", err)
+			}
 		}
+		o.report(Event{Kind: EventFileWritten, Path: destination, Action: result.Action, Diff: result.Diff})
 	}
 
-	if DryRun {
-		fmt.Fprintf(os.Stderr, "os.Chmod(%q, %v)\n", destination, filePerm)
-	} else {
-		os.Chmod(destination, filePerm)
+	changed, err := o.ensureOwnership(target, opts.Owner, opts.Group)
+	if err != nil {
+		return result, err
+	}
+	if changed && !result.Changed {
+		result.Changed = true
+		result.Action = ActionUpdated
 	}
 
-	return nil
+	return result, nil
 }
 
 // PutFileIfNotExists does not overwrite destination file if it
 // already exists, otherwise it does and returns what PutFile does.
 func PutFileIfNotExists(destination, content string, filePerm os.FileMode, dirPerm ...os.FileMode) error {
-	if !Exists(destination) {
-		return PutFile(destination, content, filePerm, dirPerm...)
+	return std().PutFileIfNotExists(destination, content, filePerm, dirPerm...)
+}
+
+// PutFileIfNotExists is PutFileIfNotExists using the settings of o.
+func (o *Ops) PutFileIfNotExists(destination, content string, filePerm os.FileMode, dirPerm ...os.FileMode) error {
+	if !o.Exists(destination) {
+		return o.PutFile(destination, content, filePerm, dirPerm...)
 	}
-	fmt.Fprintf(os.Stderr, "PutFileIfNotExists: %q already exists, skipping.\n", destination)
+	o.report(Event{Kind: EventSkipped, Path: destination, Message: fmt.Sprintf("PutFileIfNotExists: %q already exists, skipping.", destination)})
 	return nil
 }
 
@@ -75,111 +162,269 @@ func PutFileIfNotExists(destination, content string, filePerm os.FileMode, dirPe
 // an fs.FS interface to a target path on the local
 // filesystem. Returns error in case of failure.
 func PutFileFromFS(fsys fs.FS, source string, destination string, filePerm os.FileMode, dirPerm ...os.FileMode) error {
-	if DryRun {
-		if len(dirPerm) > 0 {
-			fmt.Fprintf(os.Stderr, "PutFileFromFS(<fs>, %q, %q, %v, %v)\n", source, destination, filePerm, dirPerm[0])
-		} else {
-			fmt.Fprintf(os.Stderr, "PutFileFromFS(<fs>, %q, %q, %v)\n", source, destination, filePerm)
-		}
+	return std().PutFileFromFS(fsys, source, destination, filePerm, dirPerm...)
+}
 
-	}
+// PutFileFromFS is PutFileFromFS using the settings of o.
+func (o *Ops) PutFileFromFS(fsys fs.FS, source string, destination string, filePerm os.FileMode, dirPerm ...os.FileMode) error {
+	_, err := o.PutFileFromFSWithResult(fsys, source, destination, filePerm, dirPerm...)
+	return err
+}
 
-	var directoryPermission os.FileMode = 0755
+// PutFileFromFSWithResult is PutFileFromFS returning one Result per
+// file copied. Returns results so far and error in case of failure.
+func PutFileFromFSWithResult(fsys fs.FS, source string, destination string, filePerm os.FileMode, dirPerm ...os.FileMode) ([]Result, error) {
+	return std().PutFileFromFSWithResult(fsys, source, destination, filePerm, dirPerm...)
+}
+
+// PutFileFromFSWithResult is PutFileFromFSWithResult using the settings of o.
+func (o *Ops) PutFileFromFSWithResult(fsys fs.FS, source string, destination string, filePerm os.FileMode, dirPerm ...os.FileMode) ([]Result, error) {
 	if len(dirPerm) > 0 {
-		directoryPermission = dirPerm[0]
+		o.reportCall("PutFileFromFS(<fs>, %q, %q, %v, %v)", source, destination, filePerm, dirPerm[0])
+	} else {
+		o.reportCall("PutFileFromFS(<fs>, %q, %q, %v)", source, destination, filePerm)
 	}
+	opts := FileOptions{FileMode: filePerm}
+	if len(dirPerm) > 0 {
+		opts.DirMode = dirPerm[0]
+	}
+	results, err := o.putFileFromFS(fsys, source, destination, opts)
+	return results, o.orExit(err)
+}
 
+// PutFileFromFSWithOptions copies a file or recursively copies a
+// directory from an fs.FS interface to a target path on the local
+// filesystem like PutFileFromFS, but configured by opts, see
+// FileOptions. Owner and group are set on every file and directory
+// created or copied. Returns one Result per file copied, results so
+// far and error in case of failure.
+func PutFileFromFSWithOptions(fsys fs.FS, source string, destination string, opts FileOptions) ([]Result, error) {
+	return std().PutFileFromFSWithOptions(fsys, source, destination, opts)
+}
+
+// PutFileFromFSWithOptions is PutFileFromFSWithOptions using the settings of o.
+func (o *Ops) PutFileFromFSWithOptions(fsys fs.FS, source string, destination string, opts FileOptions) ([]Result, error) {
+	o.reportCall("PutFileFromFSWithOptions(<fs>, %q, %q, %+v)", source, destination, opts)
+	results, err := o.putFileFromFS(fsys, source, destination, opts)
+	return results, o.orExit(err)
+}
+
+// putFileFromFS implements PutFileFromFSWithOptions without dry-run
+// printing the call.
+func (o *Ops) putFileFromFS(fsys fs.FS, source string, destination string, opts FileOptions) ([]Result, error) {
 	// Get the file information from the source path.
 	srcInfo, err := fs.Stat(fsys, source)
 	if err != nil {
-		return orExit(fmt.Errorf("failed to stat source path: %w", err))
+		return nil, fmt.Errorf("failed to stat source path: %w", err)
 	}
 
 	// Handle directories recursively.
 	if srcInfo.IsDir() {
-		return orExit(copyDir(fsys, source, destination, filePerm, directoryPermission))
+		results, err := o.copyDir(fsys, source, destination, opts, func(srcFile, destFile string) (Result, error) {
+			return o.copyFile(fsys, srcFile, destFile, opts)
+		})
+		return results, err
 	}
 
 	// Handle single file copy.
-	return orExit(copyFile(fsys, source, destination, filePerm, directoryPermission))
+	result, err := o.copyFile(fsys, source, destination, opts)
+	return []Result{result}, err
 }
 
-// copyDir recursively copies a directory and its contents.
-func copyDir(fsys fs.FS, srcDir string, destDir string, filePerm os.FileMode, dirPerm os.FileMode) error {
+// copyDir recursively copies a directory and its contents, creating
+// directories according to opts and calling put for every file.
+func (o *Ops) copyDir(fsys fs.FS, srcDir string, destDir string, opts FileOptions, put func(srcFile, destFile string) (Result, error)) ([]Result, error) {
+	var results []Result
 	err := fs.WalkDir(fsys, srcDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return orExit(fmt.Errorf("failed to walk directory: %w", err))
+			return fmt.Errorf("failed to walk directory: %w", err)
 		}
 
 		// Compute the relative path and destination path.
 		relPath, err := filepath.Rel(srcDir, path)
 		if err != nil {
-			return orExit(fmt.Errorf("failed to compute relative path: %w", err))
+			return fmt.Errorf("failed to compute relative path: %w", err)
 		}
 		destPath := filepath.Join(destDir, relPath)
 
 		// Handle directories.
 		if d.IsDir() {
-			if DryRun {
-				fmt.Fprintf(os.Stderr, "os.MkdirAll(%q, %v)\n", destPath, dirPerm)
-				return nil
+			target, err := o.resolve(destPath)
+			if err != nil {
+				return err
+			}
+			if _, err := o.mkdirAll(target, opts.dirMode(), opts.Owner, opts.Group); err != nil {
+				return err
 			}
-			if err := os.MkdirAll(destPath, dirPerm); err != nil {
-				return orExit(fmt.Errorf("failed to create directory: %w", err))
+			if _, err := o.ensureOwnership(target, opts.Owner, opts.Group); err != nil {
+				return err
 			}
 			return nil
 		}
 
 		// Handle files.
-		return orExit(copyFile(fsys, path, destPath, filePerm, dirPerm))
+		result, err := put(path, destPath)
+		results = append(results, result)
+		return err
 	})
 
-	return orExit(err)
+	return results, err
 }
 
 // copyFile copies a single file from fs.FS to the local filesystem.
-func copyFile(fsys fs.FS, srcFile string, destFile string, filePerm os.FileMode, dirPerm os.FileMode) error {
-	// Open the source file.
-	src, err := fsys.Open(srcFile)
+func (o *Ops) copyFile(fsys fs.FS, srcFile string, destFile string, opts FileOptions) (result Result, err error) {
+	defer func() { o.logResult(result, err) }()
+	result = Result{Action: ActionNone, Path: destFile}
+	target, err := o.resolve(destFile)
 	if err != nil {
-		return orExit(fmt.Errorf("failed to open source file: %w", err))
+		return result, err
 	}
-	defer src.Close()
+	locked, unlock, err := o.lockTarget(target)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+	filePerm := opts.fileMode()
 
-	// Create the destination file's directory.
-	destDir := filepath.Dir(destFile)
-	if DryRun {
-		fmt.Fprintf(os.Stderr, "os.MkdirAll(%q, %v)\n", destDir, dirPerm)
-		fmt.Fprintf(os.Stderr, "%q <- %q\n", destFile, srcFile)
-	} else {
-		if err := os.MkdirAll(destDir, dirPerm); err != nil {
-			return orExit(fmt.Errorf("failed to create destination directory: %w", err))
+	// Hash the current destination file, if any.
+	existing, err := os.Stat(target)
+	switch {
+	case err == nil && opts.IfNotExists:
+		return result, nil
+	case err == nil:
+		if result.BeforeHash, err = hashFile(target); err != nil {
+			return result, fmt.Errorf("failed to read destination file: %w", err)
 		}
-		// Create the destination file.
-		dest, err := os.OpenFile(destFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, filePerm)
-		//dest, err := os.Create(destFile)
-		if err != nil {
-			return orExit(fmt.Errorf("failed to create destination file: %w", err))
+	case !os.IsNotExist(err):
+		return result, err
+	}
+
+	// Hash the source file.
+	if result.AfterHash, err = hashFSFile(fsys, srcFile); err != nil {
+		return result, fmt.Errorf("failed to read source file: %w", err)
+	}
+	switch {
+	case existing == nil:
+		result.Changed = true
+		result.Action = ActionCreated
+	case result.BeforeHash != result.AfterHash || existing.Mode().Perm() != filePerm.Perm():
+		result.Changed = true
+		result.Action = ActionUpdated
+	}
+
+	if result.BeforeHash != result.AfterHash {
+		if result.Diff, err = o.fsFileDiff(fsys, srcFile, target, destFile, existing); err != nil {
+			return result, fmt.Errorf("failed to diff file: %w", err)
 		}
-		defer dest.Close()
-		// Copy the file content.
-		_, err = io.Copy(dest, src)
-		if err != nil {
-			return orExit(fmt.Errorf("failed to copy file content: %w", err))
+	}
+
+	// Create the destination file's directory.
+	if _, err := o.mkdirAll(filepath.Dir(target), opts.dirMode(), opts.Owner, opts.Group); err != nil {
+		return result, err
+	}
+
+	if existing != nil && result.BeforeHash == result.AfterHash {
+		// Leave identical content untouched, only fix the mode
+		if err := o.ensureMode(target, existing, filePerm); err != nil {
+			return result, err
+		}
+	} else {
+		if !o.DryRun {
+			src, err := fsys.Open(srcFile)
+			if err != nil {
+				return result, fmt.Errorf("failed to open source file: %w", err)
+			}
+			defer src.Close()
+			// Atomically copy the file content.
+			if err := locked.withBackup(opts.Backup).withValidator(opts.validator()).writeFileAtomic(target, src, filePerm, true); err != nil {
+				return result, fmt.Errorf("failed to copy file content: %w", err)
+			}
 		}
+		o.report(Event{Kind: EventFileWritten, Path: destFile, Action: result.Action, Diff: result.Diff})
 	}
 
+	changed, err := o.ensureOwnership(target, opts.Owner, opts.Group)
+	if err != nil {
+		return result, err
+	}
+	if changed && !result.Changed {
+		result.Changed = true
+		result.Action = ActionUpdated
+	}
+
+	return result, nil
+}
+
+// ensureMode changes the mode of target to perm unless info shows it
+// already has it. In dry-run mode the change is only printed. Returns
+// error on failure.
+func (o *Ops) ensureMode(target string, info os.FileInfo, perm os.FileMode) error {
+	if info.Mode().Perm() == perm.Perm() {
+		return nil
+	}
+	if err := o.touch(target); err != nil {
+		return err
+	}
+	if !o.DryRun {
+		if err := os.Chmod(target, perm); err != nil {
+			return err
+		}
+	}
+	o.report(Event{Kind: EventModeChanged, Path: target, Action: ActionUpdated, Message: fmt.Sprintf("os.Chmod(%q, %v)", target, perm)})
 	return nil
 }
 
+// hashFSFile returns the hex encoded SHA-256 hash of the content of
+// file name in fsys.
+func hashFSFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// fsFileDiff returns the diff between file target, described by
+// existing (nil if missing) and labelled name, and srcFile in fsys
+// like fileDiff, but summarizes large files without reading them.
+func (o *Ops) fsFileDiff(fsys fs.FS, srcFile, target, name string, existing os.FileInfo) (string, error) {
+	srcInfo, err := fs.Stat(fsys, srcFile)
+	if err != nil {
+		return "", err
+	}
+	var before []byte
+	var beforeSize int64
+	if existing != nil {
+		beforeSize = existing.Size()
+	}
+	if beforeSize > maxDiffSize || srcInfo.Size() > maxDiffSize {
+		from, to := diffNames(name, existing != nil)
+		return sizeSummary(from, to, beforeSize, srcInfo.Size()), nil
+	}
+	if existing != nil {
+		if before, err = os.ReadFile(target); err != nil {
+			return "", err
+		}
+	}
+	after, err := fs.ReadFile(fsys, srcFile)
+	if err != nil {
+		return "", err
+	}
+	return o.fileDiff(name, before, after, existing != nil), nil
+}
+
 // ListFiles recursively lists all files in the given fs.FS starting
 // from the root directory. If fsys is an embed.FS, be sure to use
 // root `.` and not `/`. Returns a string slice of paths to
 // non-directory items (files) or error is something failed.
 func ListFiles(fsys fs.FS, root string) ([]string, error) {
-	if DryRun {
-		fmt.Fprintf(os.Stderr, "ListFiles(<fs>, %q)\n", root)
-	}
+	return std().ListFiles(fsys, root)
+}
+
+// ListFiles is ListFiles using the settings of o.
+func (o *Ops) ListFiles(fsys fs.FS, root string) ([]string, error) {
+	o.reportCall("ListFiles(<fs>, %q)", root)
 	var files []string
 	err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -187,8 +432,8 @@ func ListFiles(fsys fs.FS, root string) ([]string, error) {
 		}
 		if !d.IsDir() {
 			files = append(files, path) // Collect the file path
-			if DryRun {
-				fmt.Fprintln(os.Stderr, path)
+			if o.DryRun {
+				o.report(Event{Kind: EventFileListed, Path: path, Message: path})
 			}
 		}
 		return nil
@@ -0,0 +1,118 @@
+package fileops
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPutFileIdempotent(t *testing.T) {
+	o := &Ops{}
+	fsys := fstest.MapFS{"config": {Data: []byte("Hello = world\n")}}
+	tests := []struct {
+		name   string
+		put    func(textfile string) (Result, error)
+		action Action
+		mode   os.FileMode
+	}{
+		{"same content", func(textfile string) (Result, error) {
+			return o.PutFileWithResult(textfile, "Hello = world", 0644)
+		}, ActionNone, 0644},
+		{"mode only", func(textfile string) (Result, error) {
+			return o.PutFileWithResult(textfile, "Hello = world\n", 0600)
+		}, ActionUpdated, 0600},
+		{"same file from fs", func(textfile string) (Result, error) {
+			results, err := o.PutFileFromFSWithResult(fsys, "config", textfile, 0644)
+			return results[0], err
+		}, ActionNone, 0644},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textfile := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(textfile, []byte("Hello = world\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.Stat(textfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := tt.put(textfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tt.action {
+				t.Errorf("Expected action %s, got %s", tt.action, result)
+			}
+			after, err := os.Stat(textfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(before, after) {
+				t.Error("Expected file not to be rewritten")
+			}
+			if after.Mode().Perm() != tt.mode {
+				t.Errorf("Expected mode %v, got %v", tt.mode, after.Mode().Perm())
+			}
+			if content, err := os.ReadFile(textfile); err != nil || string(content) != "Hello = world\n" {
+				t.Errorf("Expected content unchanged, got %q (%v)", content, err)
+			}
+		})
+	}
+}
+
+func TestPutFileDryRunDiff(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(textfile, []byte("Hello = world\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	dry := &Ops{DryRun: true, Stderr: &stderr}
+	if _, err := dry.PutFileWithResult(textfile, "Hello = universe", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if out := stderr.String(); !strings.Contains(out, "-Hello = world\n+Hello = universe\n") || strings.Contains(out, `"Hello = universe\n"`) {
+		t.Errorf("Expected a unified diff in dry-run output, got %q", out)
+	}
+	if content, err := os.ReadFile(textfile); err != nil || string(content) != "Hello = world\n" {
+		t.Errorf("Expected content unchanged in dry-run, got %q (%v)", content, err)
+	}
+}
+
+func TestPutFileFromFSDryRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "changed.txt"), []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"tree/changed.txt": {Data: []byte("one\n2\n")},
+		"tree/new.txt":     {Data: []byte("new\n")},
+		"tree/image.bin":   {Data: []byte("\x89PNG\x00\x01")},
+		"tree/large.txt":   {Data: bytes.Repeat([]byte("x\n"), maxDiffSize)},
+	}
+	var stderr bytes.Buffer
+	o := &Ops{DryRun: true, Stderr: &stderr}
+	results, err := o.PutFileFromFSWithResult(fsys, "tree", dir, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Errorf("Expected 4 results, got %v", results)
+	}
+	out := stderr.String()
+	for _, expected := range []string{
+		"--- a" + dir + "/changed.txt\n+++ b" + dir + "/changed.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n",
+		"--- /dev/null\n+++ b" + dir + "/new.txt\n",
+		"Binary files /dev/null and b" + dir + "/image.bin differ\n",
+		"Files /dev/null and b" + dir + "/large.txt differ (0 -> 2097152 bytes)\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in dry-run output, got %q", expected, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected new.txt not to be written in dry-run, got %v", err)
+	}
+}
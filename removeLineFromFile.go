@@ -1,118 +1,132 @@
 package fileops
 
-import (
-	"bufio"
-	"fmt"
-	"os"
-	"path"
-	"strings"
-
-	"github.com/hexops/gotextdiff"
-	"github.com/hexops/gotextdiff/myers"
-	"github.com/hexops/gotextdiff/span"
-)
-
 // RemoveLineFromFile removes line n number of times (or all of them
 // if n is -1) from textfile. If before and/or after are not nil, the
 // line before and/or after line to be removed must contain the
 // after/before string respectively. If both before and after are nil,
 // line is removed from anywhere in the file.
 func RemoveLineFromFile(textfile, line string, n int, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
-	f, err := os.OpenFile(textfile, os.O_RDWR, 0644)
-	if err != nil {
-		return orExit(err)
-	}
-	defer f.Close()
+	return std().RemoveLineFromFile(textfile, line, n, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+}
 
-	var lines []string
-	var originalLines []string
+// RemoveLineFromFile is RemoveLineFromFile using the settings of o.
+func (o *Ops) RemoveLineFromFile(textfile, line string, n int, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
+	_, err := o.RemoveLineFromFileWithResult(textfile, line, n, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	return err
+}
 
-	// Read all lines from textfile
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+// RemoveLineFromFileWithResult is RemoveLineFromFile returning a
+// Result describing whether any line was removed. Returns error on
+// failure.
+func RemoveLineFromFileWithResult(textfile, line string, n int, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) (Result, error) {
+	return std().RemoveLineFromFileWithResult(textfile, line, n, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+}
+
+// RemoveLineFromFileWithResult is RemoveLineFromFileWithResult using the settings of o.
+func (o *Ops) RemoveLineFromFileWithResult(textfile, line string, n int, before, after *string, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) (Result, error) {
+	o.reportCall("RemoveLineFromFile(%q, %q, %d, %+v, %+v, %t, %t)", textfile, line, n, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	opts := flagOptions(before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	// Prefix and full matching never fails
+	match, _ := newMatcher(line, opts.Match, opts.KeepSpaces)
+	ed := &lineRemover{match: match, n: n}
+	// Neighbouring lines only need to contain before/after as is
+	if before != nil {
+		ed.before, _ = newMatcher(*before, MatchContains, true)
 	}
-	if err := scanner.Err(); err != nil {
-		return orExit(err)
+	if after != nil {
+		ed.after, _ = newMatcher(*after, MatchContains, true)
 	}
+	return o.editLines(textfile, opts, ed)
+}
 
-	if DryRun {
-		originalLines = make([]string, len(lines))
-		copy(originalLines, lines)
-		fmt.Fprintf(os.Stderr, "RemoveLineFromFile(%q, %q, %d, %+v, %+v, %t, %t)\n", textfile, line, n, before, after, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
-	}
+// RemoveLineFromFileRegexp removes lines matching regular expression
+// pattern n number of times (or all of them if n is -1) from
+// textfile. If before and/or after are not nil, they are regular
+// expressions that the line before and/or after the line to be
+// removed must match respectively. Regular expressions are matched
+// against lines as is, leading and trailing spaces included. Returns
+// error on failure.
+func RemoveLineFromFileRegexp(textfile, pattern string, n int, before, after *string) error {
+	return std().RemoveLineFromFileRegexp(textfile, pattern, n, before, after)
+}
 
-	// Remove the target line up to `n` times
-	lineRemoved := false
-	removalCount := 0
-	filteredLines := []string{}
+// RemoveLineFromFileRegexp is RemoveLineFromFileRegexp using the settings of o.
+func (o *Ops) RemoveLineFromFileRegexp(textfile, pattern string, n int, before, after *string) error {
+	o.reportCall("RemoveLineFromFileRegexp(%q, %q, %d, %+v, %+v)", textfile, pattern, n, before, after)
+	_, err := o.removeLineFromFile(textfile, pattern, n, regexpOptions(pattern, before, after))
+	return err
+}
 
-	for i := 0; i < len(lines); i++ {
-		if n != -1 && removalCount >= n {
-			// If we've removed `n` lines, append the rest unchanged
-			filteredLines = append(filteredLines, lines[i:]...)
-			break
-		}
+// RemoveLineFromFileWithOptions removes lines matching line from
+// textfile, at most opts.Count lines (or all of them if 0). If
+// opts.Before and/or opts.After are not empty, the line before and/or
+// after the line to be removed must match opts.Before/opts.After
+// respectively. See LineOptions for how lines are matched and other
+// options. Returns a Result describing the change or error on
+// failure.
+func RemoveLineFromFileWithOptions(textfile, line string, opts LineOptions) (Result, error) {
+	return std().RemoveLineFromFileWithOptions(textfile, line, opts)
+}
 
-		currentLine := lines[i]
-		trimmedLine := currentLine
-		if !matchWithLeadingAndTrailingSpaces {
-			trimmedLine = strings.TrimSpace(currentLine)
-		}
+// RemoveLineFromFileWithOptions is RemoveLineFromFileWithOptions using the settings of o.
+func (o *Ops) RemoveLineFromFileWithOptions(textfile, line string, opts LineOptions) (Result, error) {
+	o.reportCall("RemoveLineFromFileWithOptions(%q, %q, %+v)", textfile, line, opts)
+	return o.removeLineFromFile(textfile, line, opts.count(), opts)
+}
 
-		matches := false
-		if matchFullStringNotJustPrefix {
-			matches = trimmedLine == line
-		} else {
-			matches = strings.HasPrefix(trimmedLine, line)
-		}
+// removeLineFromFile implements RemoveLineFromFileWithOptions without
+// dry-run printing the call, removing at most n lines (all if n is
+// -1) regardless of opts.Count.
+func (o *Ops) removeLineFromFile(textfile, line string, n int, opts LineOptions) (Result, error) {
+	match, before, after, err := opts.matchers(line)
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
+	}
+	return o.editLines(textfile, opts, &lineRemover{match: match, before: before, after: after, n: n})
+}
 
-		if matches {
-			// Check `before` and `after` conditions
-			beforeMatch := before == nil || (i > 0 && strings.Contains(lines[i-1], *before))
-			afterMatch := after == nil || (i < len(lines)-1 && strings.Contains(lines[i+1], *after))
+// lineRemover is a lineEditor removing lines matching match n number
+// of times (or all of them if n is -1). If before and/or after are not
+// nil, the line before and/or after the line to be removed must match
+// before/after respectively. Each line is held back until the next one
+// is known.
+type lineRemover struct {
+	match, before, after matcher
+	n                    int
+	removed              int
+	prev, pending        *string
+}
 
-			if beforeMatch && afterMatch {
-				lineRemoved = true
-				removalCount++
-				continue // Skip this line
-			}
-		}
+func (r *lineRemover) scan(string) {}
 
-		// Keep this line
-		filteredLines = append(filteredLines, currentLine)
-	}
+func (r *lineRemover) prepare() (Action, error) {
+	return ActionRemoved, nil
+}
 
-	// If no line is removed, exit early
-	if !lineRemoved {
-		return nil
+func (r *lineRemover) edit(line string, emit func(line string)) {
+	if r.pending != nil {
+		r.flush(&line, emit)
 	}
+	r.pending = &line
+}
 
-	lines = filteredLines
-
-	if DryRun {
-		// Show diff
-		origStrings := strings.Join(originalLines, "\n")
-		edits := myers.ComputeEdits(span.URIFromPath(path.Join("a", textfile)), origStrings, strings.Join(lines, "\n"))
-		diff := fmt.Sprint(gotextdiff.ToUnified(path.Join("a", textfile), path.Join("b", textfile), origStrings, edits))
-		if len(diff) > 0 {
-			fmt.Fprintln(os.Stderr, diff)
-		}
-		return nil
+func (r *lineRemover) end(emit func(line string)) {
+	if r.pending != nil {
+		r.flush(nil, emit)
 	}
+}
 
-	// Write lines back to textfile
-	if err := f.Truncate(0); err != nil {
-		return orExit(err)
-	}
-	if _, err := f.Seek(0, 0); err != nil {
-		return orExit(err)
-	}
-	writer := bufio.NewWriter(f)
-	for _, line := range lines {
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			return orExit(err)
-		}
+// flush emits the pending line unless it is to be removed given the
+// next line (nil at the end).
+func (r *lineRemover) flush(next *string, emit func(line string)) {
+	line := *r.pending
+	remove := (r.n == -1 || r.removed < r.n) && r.match(line) &&
+		(r.before == nil || r.prev != nil && r.before(*r.prev)) &&
+		(r.after == nil || next != nil && r.after(*next))
+	if remove {
+		r.removed++
+	} else {
+		emit(line)
 	}
-	return orExit(writer.Flush())
+	r.prev, r.pending = r.pending, nil
 }
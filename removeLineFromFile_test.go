@@ -2,6 +2,7 @@ package fileops
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -71,6 +72,30 @@ func TestRemoveLineFromFile(t *testing.T) {
 			expectedContent: "line1\nbefore\nafter\nline3\n",
 			expectError:     false,
 		},
+		{
+			name:            "Match before/after in untrimmed neighbouring lines",
+			initialContent:  " a\na b\nb\nab\n",
+			line:            "a",
+			n:               -1,
+			before:          ptr(" a"),
+			after:           ptr("b"),
+			matchFullString: false,
+			matchSpaces:     false,
+			expectedContent: " a\nb\nab\n",
+			expectError:     false,
+		},
+		{
+			name:            "Empty before matches any line",
+			initialContent:  "a\nb\na\n",
+			line:            "a",
+			n:               -1,
+			before:          ptr(""),
+			after:           nil,
+			matchFullString: true,
+			matchSpaces:     false,
+			expectedContent: "a\nb\n",
+			expectError:     false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -95,6 +120,26 @@ func TestRemoveLineFromFile(t *testing.T) {
 	}
 }
 
+func TestRemoveLineFromFileRegexp(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "fstab")
+	if err := PutFile(textfile, "UUID=1 / ext4 defaults 0 1\n/dev/sdb1 /mnt ext4 defaults 0 2\n# /dev/sdc1 /old ext4 defaults 0 2\n/dev/sdc1 /old ext4 defaults 0 2", 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := `^#`
+	if err := RemoveLineFromFileRegexp(textfile, `^/dev/sd[a-z]\d+\s`, -1, &before, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "UUID=1 / ext4 defaults 0 1\n/dev/sdb1 /mnt ext4 defaults 0 2\n# /dev/sdc1 /old ext4 defaults 0 2\n"; string(content) != expected {
+		t.Errorf("Expected content:\n%q\nGot:\n%q\n", expected, content)
+	}
+}
+
 // Helper to create a pointer to a string
 func ptr(s string) *string {
 	return &s
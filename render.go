@@ -0,0 +1,244 @@
+package fileops
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ColorMode decides when a DiffRenderer colors diffs.
+type ColorMode int
+
+const (
+	// ColorAuto colors diffs written to a terminal unless the
+	// NO_COLOR environment variable is set (see https://no-color.org).
+	ColorAuto ColorMode = iota
+	// ColorAlways always colors diffs.
+	ColorAlways
+	// ColorNever never colors diffs.
+	ColorNever
+)
+
+// ANSI escape sequences used to color diffs.
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiRed       = "\x1b[31m"
+	ansiGreen     = "\x1b[32m"
+	ansiCyan      = "\x1b[36m"
+	ansiReverse   = "\x1b[7m"
+	ansiNoReverse = "\x1b[27m"
+)
+
+// DiffRenderer renders unified diffs for humans, see
+// TextReporter.Renderer. Removed lines are colored red and added
+// lines green. When a number of removed lines are directly replaced
+// by the same number of added lines, the words that differ within
+// each pair of lines are highlighted.
+type DiffRenderer struct {
+	Color ColorMode
+	// Width, if positive, truncates lines longer than Width columns.
+	// If 0, lines are truncated to the width of the terminal when
+	// writing to one (or $COLUMNS if it can not be determined).
+	// Negative never truncates lines.
+	Width int
+}
+
+// Render returns diff rendered for writing to w.
+func (r *DiffRenderer) Render(w io.Writer, diff string) string {
+	terminal := isTerminal(w)
+	color := r.Color == ColorAlways || (r.Color == ColorAuto && terminal && os.Getenv("NO_COLOR") == "")
+	width := r.Width
+	if width == 0 {
+		width = -1
+		if terminal {
+			width = terminalWidth(w.(*os.File))
+		}
+	}
+
+	lines := strings.SplitAfter(diff, "\n")
+	var b strings.Builder
+	inHunk := false
+	for i := 0; i < len(lines); i++ {
+		switch {
+		case !inHunk && (strings.HasPrefix(lines[i], "--- ") || strings.HasPrefix(lines[i], "+++ ")):
+			writeSegments(&b, []segment{{text: lines[i]}}, ansiBold, color, width)
+		case strings.HasPrefix(lines[i], "@@"):
+			inHunk = true
+			writeSegments(&b, []segment{{text: lines[i]}}, ansiCyan, color, width)
+		case strings.HasPrefix(lines[i], "-"):
+			// Pair a run of removed lines with the added lines
+			// directly following it
+			removed := run(lines[i:], "-")
+			added := run(lines[i+len(removed):], "+")
+			if len(removed) != len(added) {
+				added = nil
+			}
+			for j, line := range removed {
+				var other string
+				if added != nil {
+					other = added[j]
+				}
+				writeChanged(&b, line, other, ansiRed, color, width)
+			}
+			for j, line := range added {
+				writeChanged(&b, line, removed[j], ansiGreen, color, width)
+			}
+			i += len(removed) + len(added) - 1
+		case strings.HasPrefix(lines[i], "+"):
+			writeChanged(&b, lines[i], "", ansiGreen, color, width)
+		default:
+			writeSegments(&b, []segment{{text: lines[i]}}, "", color, width)
+		}
+	}
+	return b.String()
+}
+
+// segment is part of a line, highlighted if it differs from the
+// line it replaces.
+type segment struct {
+	text      string
+	highlight bool
+}
+
+// run returns the leading lines starting with prefix.
+func run(lines []string, prefix string) []string {
+	n := 0
+	for n < len(lines) && strings.HasPrefix(lines[n], prefix) {
+		n++
+	}
+	return lines[:n]
+}
+
+// writeChanged writes changed line (with its -/+ prefix) to b in
+// color, highlighting the words that differ from other unless other
+// is empty.
+func writeChanged(b *strings.Builder, line, other, color string, colored bool, width int) {
+	segments := []segment{{text: line}}
+	if other != "" && colored {
+		segments = wordDiff(line, other)
+	}
+	writeSegments(b, segments, color, colored, width)
+}
+
+// wordDiff splits line into segments where the words between the
+// common leading and trailing words of line and other (ignoring their
+// -/+ prefixes) are highlighted. If the lines have no words in
+// common, nothing is highlighted.
+func wordDiff(line, other string) []segment {
+	prefix, body := line[:1], strings.TrimSuffix(line[1:], "\n")
+	a, o := words(body), words(strings.TrimSuffix(other[1:], "\n"))
+	head := 0
+	for head < len(a) && head < len(o) && a[head] == o[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(a)-head && tail < len(o)-head && a[len(a)-1-tail] == o[len(o)-1-tail] {
+		tail++
+	}
+	if head == 0 && tail == 0 {
+		return []segment{{text: line}}
+	}
+	newline := strings.TrimPrefix(line, prefix+body)
+	return []segment{
+		{text: prefix + strings.Join(a[:head], "")},
+		{text: strings.Join(a[head:len(a)-tail], ""), highlight: true},
+		{text: strings.Join(a[len(a)-tail:], "") + newline},
+	}
+}
+
+// words splits s into words, i.e runs of letters and digits, and
+// single other characters.
+func words(s string) []string {
+	var words []string
+	for len(s) > 0 {
+		n := 0
+		for n < len(s) {
+			c, size := utf8.DecodeRuneInString(s[n:])
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				if n == 0 {
+					n = size
+				}
+				break
+			}
+			n += size
+		}
+		words = append(words, s[:n])
+		s = s[n:]
+	}
+	return words
+}
+
+// writeSegments writes the segments of a line to b, truncated to
+// width columns unless width is negative, in color if colored.
+func writeSegments(b *strings.Builder, segments []segment, color string, colored bool, width int) {
+	if width > 0 {
+		segments = truncate(segments, width)
+	}
+	if colored && color != "" {
+		b.WriteString(color)
+	}
+	var newline bool
+	for _, s := range segments {
+		text := s.text
+		if strings.HasSuffix(text, "\n") {
+			text, newline = strings.TrimSuffix(text, "\n"), true
+		}
+		if colored && s.highlight && text != "" {
+			text = ansiReverse + text + ansiNoReverse
+		}
+		b.WriteString(text)
+	}
+	if colored && color != "" {
+		b.WriteString(ansiReset)
+	}
+	if newline {
+		b.WriteString("\n")
+	}
+}
+
+// truncate cuts segments after width-1 characters followed by an
+// ellipsis if they are longer than width characters (not counting a
+// trailing newline).
+func truncate(segments []segment, width int) []segment {
+	length := 0
+	for _, s := range segments {
+		length += utf8.RuneCountInString(strings.TrimSuffix(s.text, "\n"))
+	}
+	if length <= width {
+		return segments
+	}
+	var truncated []segment
+	remaining := width - 1
+	for _, s := range segments {
+		text := strings.TrimSuffix(s.text, "\n")
+		if n := utf8.RuneCountInString(text); n > remaining {
+			text = string([]rune(text)[:remaining])
+		}
+		remaining -= utf8.RuneCountInString(text)
+		truncated = append(truncated, segment{text: text, highlight: s.highlight})
+	}
+	return append(truncated, segment{text: "…\n"})
+}
+
+// isTerminal reports whether w is a terminal (character device).
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// columns returns the terminal width according to $COLUMNS or -1 if
+// not set.
+func columns() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return -1
+}
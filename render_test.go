@@ -0,0 +1,52 @@
+package fileops
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffRenderer(t *testing.T) {
+	diff := "--- a/sshd_config\n+++ b/sshd_config\n@@ -1,3 +1,3 @@\n # comment\n-Port 22\n+Port 2222\n--- removed\n"
+	var buf bytes.Buffer
+	tests := []struct {
+		name     string
+		renderer DiffRenderer
+		expected string
+	}{
+		{"auto without terminal", DiffRenderer{Width: -1}, diff},
+		{"never", DiffRenderer{Color: ColorNever, Width: -1}, diff},
+		{"always", DiffRenderer{Color: ColorAlways, Width: -1},
+			"\x1b[1m--- a/sshd_config\x1b[0m\n\x1b[1m+++ b/sshd_config\x1b[0m\n\x1b[36m@@ -1,3 +1,3 @@\x1b[0m\n # comment\n" +
+				"\x1b[31m-Port \x1b[7m22\x1b[27m\x1b[0m\n\x1b[32m+Port \x1b[7m2222\x1b[27m\x1b[0m\n\x1b[31m--- removed\x1b[0m\n"},
+		{"width", DiffRenderer{Color: ColorNever, Width: 8}, "--- a/s…\n+++ b/s…\n@@ -1,3…\n # comm…\n-Port 22\n+Port 2…\n--- rem…\n"},
+	}
+	for _, tt := range tests {
+		if got := tt.renderer.Render(&buf, diff); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestDiffContext(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(textfile, []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for context, expected := range map[int]string{
+		0:  "@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+four\n 5\n 6\n 7\n",
+		1:  "@@ -3,3 +3,3 @@\n 3\n-4\n+four\n 5\n",
+		-1: "@@ -4 +4 @@\n-4\n+four\n",
+	} {
+		o := &Ops{DryRun: true, DiffContext: context, Reporter: SilentReporter{}}
+		result, err := o.ReplaceLineInFileWithOptions(textfile, "4", "four", LineOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(result.Diff, expected) {
+			t.Errorf("DiffContext %d: expected diff ending with %q, got %q", context, expected, result.Diff)
+		}
+	}
+}
@@ -1,135 +1,168 @@
 package fileops
 
 import (
-	"bufio"
 	"errors"
-	"fmt"
-	"os"
-	"path"
-	"strings"
-
-	"github.com/hexops/gotextdiff"
-	"github.com/hexops/gotextdiff/myers"
-	"github.com/hexops/gotextdiff/span"
+	"regexp"
 )
 
 func ReplaceLineInFile(textfile, lineToReplace, replaceWithLine string, n int, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
-	f, err := os.OpenFile(textfile, os.O_RDWR, 0644)
-	if err != nil {
-		return orExit(err)
-	}
-	defer f.Close()
+	return std().ReplaceLineInFile(textfile, lineToReplace, replaceWithLine, n, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+}
 
-	var lines []string
-	var originalLines []string
+// ReplaceLineInFile is ReplaceLineInFile using the settings of o.
+func (o *Ops) ReplaceLineInFile(textfile, lineToReplace, replaceWithLine string, n int, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
+	_, err := o.ReplaceLineInFileWithResult(textfile, lineToReplace, replaceWithLine, n, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	return err
+}
 
-	// Read all lines from textfile
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-	if err := scanner.Err(); err != nil {
-		return orExit(err)
-	}
+// ReplaceLineInFileWithResult is ReplaceLineInFile returning a Result
+// describing whether any line was replaced. Returns error on failure.
+func ReplaceLineInFileWithResult(textfile, lineToReplace, replaceWithLine string, n int, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) (Result, error) {
+	return std().ReplaceLineInFileWithResult(textfile, lineToReplace, replaceWithLine, n, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+}
 
-	if DryRun {
-		originalLines = make([]string, len(lines))
-		copy(originalLines, lines)
-		fmt.Fprintf(os.Stderr, "ReplaceLineInFile(%q, %q, %q, %d, %t, %t)\n", textfile, lineToReplace, replaceWithLine, n, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
-	}
+// ReplaceLineInFileWithResult is ReplaceLineInFileWithResult using the settings of o.
+func (o *Ops) ReplaceLineInFileWithResult(textfile, lineToReplace, replaceWithLine string, n int, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) (Result, error) {
+	o.reportCall("ReplaceLineInFile(%q, %q, %q, %d, %t, %t)", textfile, lineToReplace, replaceWithLine, n, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+	return o.replaceLineInFile(textfile, lineToReplace, replaceWithLine, n, flagOptions(nil, nil, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces))
+}
 
-	// Replace lineToReplace with replaceWithLine in lines slice, liens
-	// slice will be modified
-	if err := ReplaceLineInLines(&lines, lineToReplace, replaceWithLine, n, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces); err != nil {
-		return orExit(err)
-	}
+func ReplaceLineInLines(lines *[]string, lineToReplace string, replaceWithLine string, n int, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
+	return std().ReplaceLineInLines(lines, lineToReplace, replaceWithLine, n, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces)
+}
 
-	if DryRun {
-		// Show diff
-		origStrings := strings.Join(originalLines, "\n")
-		edits := myers.ComputeEdits(span.URIFromPath(path.Join("a", textfile)), origStrings, strings.Join(lines, "\n"))
-		diff := fmt.Sprint(gotextdiff.ToUnified(path.Join("a", textfile), path.Join("b", textfile), origStrings, edits))
-		if len(diff) > 0 {
-			fmt.Fprintln(os.Stderr, diff)
-		}
-		return nil
-	}
+// ReplaceLineInLines is ReplaceLineInLines using the settings of o.
+func (o *Ops) ReplaceLineInLines(lines *[]string, lineToReplace string, replaceWithLine string, n int, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
+	return o.replaceLineInLines(lines, lineToReplace, replaceWithLine, n, flagOptions(nil, nil, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces))
+}
 
-	// Write lines back to textfile
-	if err := f.Truncate(0); err != nil {
-		return orExit(err)
-	}
-	if _, err := f.Seek(0, 0); err != nil {
-		return orExit(err)
-	}
-	writer := bufio.NewWriter(f)
-	for _, line := range lines {
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			return orExit(err)
-		}
+// ReplaceLineInFileRegexp replaces lines in textfile matching regular
+// expression pattern n number of times (or all of them if n is -1)
+// with replaceWithLine. The replacement may refer to capture groups
+// of pattern using $1, ${1} or ${name} (see regexp.Regexp.Expand),
+// e.g pattern `^#?\s*Port\s+(\d+)` and replaceWithLine `Port $1`
+// uncomments a Port setting keeping its value. Returns error on
+// failure.
+func ReplaceLineInFileRegexp(textfile, pattern, replaceWithLine string, n int) error {
+	return std().ReplaceLineInFileRegexp(textfile, pattern, replaceWithLine, n)
+}
+
+// ReplaceLineInFileRegexp is ReplaceLineInFileRegexp using the settings of o.
+func (o *Ops) ReplaceLineInFileRegexp(textfile, pattern, replaceWithLine string, n int) error {
+	o.reportCall("ReplaceLineInFileRegexp(%q, %q, %q, %d)", textfile, pattern, replaceWithLine, n)
+	_, err := o.replaceLineInFile(textfile, pattern, replaceWithLine, n, regexpOptions(pattern, nil, nil))
+	return err
+}
+
+// ReplaceLineInLinesRegexp replaces lines in lines string pointer
+// slice matching regular expression pattern like
+// ReplaceLineInFileRegexp. Returns error on failure.
+func ReplaceLineInLinesRegexp(lines *[]string, pattern, replaceWithLine string, n int) error {
+	return std().ReplaceLineInLinesRegexp(lines, pattern, replaceWithLine, n)
+}
+
+// ReplaceLineInLinesRegexp is ReplaceLineInLinesRegexp using the settings of o.
+func (o *Ops) ReplaceLineInLinesRegexp(lines *[]string, pattern, replaceWithLine string, n int) error {
+	return o.replaceLineInLines(lines, pattern, replaceWithLine, n, regexpOptions(pattern, nil, nil))
+}
+
+// ReplaceLineInFileWithOptions replaces lines in textfile matching
+// lineToReplace with replaceWithLine, at most opts.Count lines (or all
+// of them if 0). In MatchRegexp mode, replaceWithLine may refer to
+// capture groups of lineToReplace using $1, ${1} or ${name}. See
+// LineOptions for how lines are matched and other options. Returns a
+// Result describing the change or error on failure.
+func ReplaceLineInFileWithOptions(textfile, lineToReplace, replaceWithLine string, opts LineOptions) (Result, error) {
+	return std().ReplaceLineInFileWithOptions(textfile, lineToReplace, replaceWithLine, opts)
+}
+
+// ReplaceLineInFileWithOptions is ReplaceLineInFileWithOptions using the settings of o.
+func (o *Ops) ReplaceLineInFileWithOptions(textfile, lineToReplace, replaceWithLine string, opts LineOptions) (Result, error) {
+	o.reportCall("ReplaceLineInFileWithOptions(%q, %q, %q, %+v)", textfile, lineToReplace, replaceWithLine, opts)
+	return o.replaceLineInFile(textfile, lineToReplace, replaceWithLine, opts.count(), opts)
+}
+
+// ReplaceLineInLinesWithOptions replaces lines in lines string
+// pointer slice like ReplaceLineInFileWithOptions. Returns error on
+// failure.
+func ReplaceLineInLinesWithOptions(lines *[]string, lineToReplace, replaceWithLine string, opts LineOptions) error {
+	return std().ReplaceLineInLinesWithOptions(lines, lineToReplace, replaceWithLine, opts)
+}
+
+// ReplaceLineInLinesWithOptions is ReplaceLineInLinesWithOptions using the settings of o.
+func (o *Ops) ReplaceLineInLinesWithOptions(lines *[]string, lineToReplace, replaceWithLine string, opts LineOptions) error {
+	return o.replaceLineInLines(lines, lineToReplace, replaceWithLine, opts.count(), opts)
+}
+
+// replaceLineInFile implements ReplaceLineInFileWithOptions without
+// dry-run printing the call, replacing at most n lines (all if n is
+// -1) regardless of opts.Count.
+func (o *Ops) replaceLineInFile(textfile, lineToReplace, replaceWithLine string, n int, opts LineOptions) (Result, error) {
+	match, replace, err := opts.replacer(lineToReplace, replaceWithLine)
+	if err != nil {
+		return Result{Action: ActionNone, Path: textfile}, o.orExit(err)
 	}
-	return orExit(writer.Flush())
+	return o.editLines(textfile, opts, &lineReplacer{match: match, replace: replace, n: n})
 }
 
-func ReplaceLineInLines(lines *[]string, lineToReplace string, replaceWithLine string, n int, matchFullStringNotJustPrefix, matchWithLeadingAndTrailingSpaces bool) error {
+// replaceLineInLines implements ReplaceLineInLinesWithOptions,
+// replacing at most n lines (all if n is -1) regardless of
+// opts.Count.
+func (o *Ops) replaceLineInLines(lines *[]string, lineToReplace, replaceWithLine string, n int, opts LineOptions) error {
 	if lines == nil {
-		return orExit(errors.New("nil pointer"))
+		return o.orExit(errors.New("nil pointer"))
 	}
-
-	// Deref lines pointer
-	slice := *lines
-
-	// Function to find indices
-	findLine := func(target string, startIndex int) int {
-		for i, l := range slice {
-			if i < startIndex {
-				continue
-			}
-			if matchWithLeadingAndTrailingSpaces {
-				if matchFullStringNotJustPrefix {
-					if l == target {
-						return i
-					}
-				} else {
-					if strings.HasPrefix(l, target) {
-						return i
-					}
-				}
-			} else {
-				if matchFullStringNotJustPrefix {
-					if strings.TrimSpace(l) == target {
-						return i
-					}
-				} else {
-					if strings.HasPrefix(strings.TrimSpace(l), target) {
-						return i
-					}
-				}
-			}
-		}
-		return -1
+	match, replace, err := opts.replacer(lineToReplace, replaceWithLine)
+	if err != nil {
+		return o.orExit(err)
 	}
+	*lines, _, _ = editSlice(&lineReplacer{match: match, replace: replace, n: n}, *lines)
+	return nil
+}
+
+// lineReplacer is a lineEditor replacing the first n lines (or all
+// of them if n is -1) matching match with the line returned by replace
+// given the line being replaced.
+type lineReplacer struct {
+	match    matcher
+	replace  func(line string) string
+	n        int
+	replaced int
+}
 
-	lineIndex := 0
+func (r *lineReplacer) scan(string) {}
 
-	if n == -1 {
-		n = len(slice)
+func (r *lineReplacer) prepare() (Action, error) {
+	return ActionReplaced, nil
+}
+
+func (r *lineReplacer) edit(line string, emit func(line string)) {
+	if (r.n == -1 || r.replaced < r.n) && r.match(line) {
+		line = r.replace(line)
+		r.replaced++
 	}
-	for i := 0; i < n; i++ {
-		// Find lineToReplace
-		lineIndex = findLine(lineToReplace, lineIndex)
-		if lineIndex == -1 {
-			break // nothing (more) to replace
-		}
-		// Replace lineToReplace with replaceWithLine
-		slice[lineIndex] = replaceWithLine
-		if lineIndex < len(slice)-1 {
-			lineIndex++
-		} else {
-			break
+	emit(line)
+}
+
+func (r *lineReplacer) end(func(line string)) {}
+
+// replacer returns a matcher for lineToReplace and a function
+// returning the replacement for a matched line, replaceWithLine with
+// capture groups expanded in MatchRegexp mode. Returns error if
+// lineToReplace is an invalid regular expression.
+func (opts LineOptions) replacer(lineToReplace, replaceWithLine string) (matcher, func(line string) string, error) {
+	if opts.Match == MatchRegexp {
+		re, err := regexp.Compile(lineToReplace)
+		if err != nil {
+			return nil, nil, err
 		}
+		return re.MatchString, func(line string) string {
+			return string(re.ExpandString(nil, replaceWithLine, line, re.FindStringSubmatchIndex(line)))
+		}, nil
 	}
-
-	*lines = slice
-	return nil
+	match, err := newMatcher(lineToReplace, opts.Match, opts.KeepSpaces)
+	if err != nil {
+		return nil, nil, err
+	}
+	return match, func(string) string { return replaceWithLine }, nil
 }
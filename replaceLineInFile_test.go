@@ -121,3 +121,31 @@ func TestReplaceLineInLines(t *testing.T) {
 	compareLines(t, &lines, expectedLines)
 
 }
+
+func TestReplaceLineInLinesRegexp(t *testing.T) {
+	lines := []string{
+		"#Port 2222",
+		"# PermitRootLogin yes",
+		"PasswordAuthentication yes",
+		"#Port 22",
+	}
+
+	expectedLines := []string{
+		"Port 2222",
+		"# PermitRootLogin yes",
+		"PasswordAuthentication no",
+		"#Port 22",
+	}
+
+	if err := ReplaceLineInLinesRegexp(&lines, `^#?\s*Port\s+(\d+)$`, "Port $1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceLineInLinesRegexp(&lines, `^(?P<key>PasswordAuthentication)\s`, "${key} no", -1); err != nil {
+		t.Fatal(err)
+	}
+	compareLines(t, &lines, expectedLines)
+
+	if err := ReplaceLineInLinesRegexp(&lines, `(`, "invalid", -1); err == nil {
+		t.Error("Expected error from invalid regular expression")
+	}
+}
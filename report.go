@@ -0,0 +1,150 @@
+package fileops
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// EventKind identifies what an Event reports.
+type EventKind string
+
+const (
+	// EventCall reports a call to a function in dry-run mode.
+	EventCall EventKind = "call"
+	// EventFileWritten reports a file created or updated as a whole.
+	EventFileWritten EventKind = "file_written"
+	// EventDirCreated reports a directory created.
+	EventDirCreated EventKind = "dir_created"
+	// EventLineInserted reports lines (or a block) inserted or moved
+	// by the line editors.
+	EventLineInserted EventKind = "line_inserted"
+	// EventLineReplaced reports lines (or a block) replaced.
+	EventLineReplaced EventKind = "line_replaced"
+	// EventLineRemoved reports lines (or a block) removed.
+	EventLineRemoved EventKind = "line_removed"
+	// EventModeChanged reports a changed file mode.
+	EventModeChanged EventKind = "mode_changed"
+	// EventOwnershipChanged reports a changed owner and/or group.
+	EventOwnershipChanged EventKind = "ownership_changed"
+	// EventBackup reports a backup made before modifying a file.
+	EventBackup EventKind = "backup"
+	// EventCommandRun reports a command run.
+	EventCommandRun EventKind = "command_run"
+	// EventSkipped reports an operation skipped, e.g because a file
+	// already exists.
+	EventSkipped EventKind = "skipped"
+	// EventFileListed reports a file listed by ListFiles in dry-run
+	// mode.
+	EventFileListed EventKind = "file_listed"
+)
+
+// Event is an operation (or in dry-run mode, an operation that would
+// have been performed) reported to a Reporter.
+type Event struct {
+	Kind EventKind `json:"kind"`
+	// DryRun is true if the operation was not actually performed.
+	DryRun  bool   `json:"dryRun"`
+	Path    string `json:"path,omitempty"`
+	Command string `json:"command,omitempty"`
+	Action  Action `json:"action,omitempty"`
+	// Message is a human readable description of the event, e.g the
+	// function call or the equivalent os package call.
+	Message string `json:"message,omitempty"`
+	// Diff is the unified diff of a changed file, if any.
+	Diff string `json:"diff,omitempty"`
+}
+
+// Reporter receives the events of operations performed by an Ops,
+// see Ops.Reporter. Report may be called concurrently when an Ops is
+// shared between goroutines.
+type Reporter interface {
+	Report(ev Event)
+}
+
+// DefaultReporter, if not nil, is the Reporter used by the top-level
+// functions. If nil, a TextReporter writing to os.Stderr is used.
+var DefaultReporter Reporter
+
+// SetReporter sets DefaultReporter.
+func SetReporter(r Reporter) {
+	DefaultReporter = r
+}
+
+// TextReporter writes events as human readable text to W (os.Stderr
+// if nil): the Message of the event on one line followed by its Diff,
+// rendered by Renderer unless nil (e.g &DiffRenderer{} for colored
+// diffs on a terminal). Unless Verbose is true, only dry-run events,
+// commands run and skipped operations are written.
+type TextReporter struct {
+	W        io.Writer
+	Verbose  bool
+	Renderer *DiffRenderer
+	mu       sync.Mutex
+}
+
+// Report implements Reporter.
+func (r *TextReporter) Report(ev Event) {
+	if !ev.DryRun && !r.Verbose && ev.Kind != EventCommandRun && ev.Kind != EventSkipped {
+		return
+	}
+	w := r.W
+	if w == nil {
+		w = os.Stderr
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ev.Message != "" {
+		fmt.Fprintln(w, ev.Message)
+	}
+	if ev.Diff != "" && r.Renderer != nil {
+		fmt.Fprintln(w, r.Renderer.Render(w, ev.Diff))
+	} else if ev.Diff != "" {
+		fmt.Fprintln(w, ev.Diff)
+	}
+}
+
+// JSONReporter writes every event as a JSON object on a line of its
+// own (JSON lines) to W (os.Stderr if nil).
+type JSONReporter struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+// Report implements Reporter.
+func (r *JSONReporter) Report(ev Event) {
+	w := r.W
+	if w == nil {
+		w = os.Stderr
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	json.NewEncoder(w).Encode(ev)
+}
+
+// SilentReporter discards all events.
+type SilentReporter struct{}
+
+// Report implements Reporter.
+func (SilentReporter) Report(Event) {}
+
+// report sends ev, marked with the dry-run state of o, to the
+// Reporter of o or a TextReporter writing to the stderr of o if nil.
+func (o *Ops) report(ev Event) {
+	ev.DryRun = o.DryRun
+	if o.Reporter != nil {
+		o.Reporter.Report(ev)
+		return
+	}
+	(&TextReporter{W: o.stderr()}).Report(ev)
+}
+
+// reportCall reports a call to a function, described by format and
+// args, in dry-run mode.
+func (o *Ops) reportCall(format string, args ...any) {
+	if o.DryRun {
+		o.report(Event{Kind: EventCall, Message: fmt.Sprintf(format, args...)})
+	}
+}
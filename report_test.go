@@ -0,0 +1,76 @@
+package fileops
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONReporter(t *testing.T) {
+	dir := t.TempDir()
+	var events, stderr bytes.Buffer
+	o := &Ops{DryRun: true, Stderr: &stderr, Reporter: &JSONReporter{W: &events}}
+	if _, err := o.PutFileWithOptions(filepath.Join(dir, "etc", "motd"), "Hello", FileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.EnsureLineInFileWithOptions(filepath.Join(dir, "hosts"), "127.0.0.1 localhost", LineOptions{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("Expected no text output, got %q", stderr.String())
+	}
+
+	var kinds []string
+	scanner := bufio.NewScanner(&events)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if !ev.DryRun {
+			t.Errorf("Expected dry-run event, got %+v", ev)
+		}
+		if ev.Kind == EventFileWritten && !strings.Contains(ev.Diff, "+Hello") {
+			t.Errorf("Expected diff in event, got %+v", ev)
+		}
+		kinds = append(kinds, string(ev.Kind))
+	}
+	expected := "call dir_created file_written call line_inserted command_run call"
+	if got := strings.Join(kinds, " "); got != expected {
+		t.Errorf("Expected events %q, got %q", expected, got)
+	}
+}
+
+func TestTextReporter(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "hosts")
+	var out bytes.Buffer
+	quiet := &Ops{Reporter: &TextReporter{W: &out}}
+	if _, err := quiet.EnsureLineInFileWithOptions(textfile, "127.0.0.1 localhost", LineOptions{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output without Verbose, got %q", out.String())
+	}
+	verbose := &Ops{Reporter: &TextReporter{W: &out, Verbose: true}}
+	if _, err := verbose.EnsureLineInFileWithOptions(textfile, "::1 localhost", LineOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "+::1 localhost\n") {
+		t.Errorf("Expected diff in verbose output, got %q", out.String())
+	}
+
+	var stderr bytes.Buffer
+	silent := &Ops{DryRun: true, Stderr: &stderr, Reporter: SilentReporter{}}
+	if err := silent.Run("true"); err != nil {
+		t.Fatal(err)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("Expected no output from SilentReporter, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,78 @@
+package fileops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Action describes what a function did, or would have done in
+// dry-run mode.
+type Action string
+
+const (
+	ActionNone     Action = "none"     // Nothing needed to be done
+	ActionCreated  Action = "created"  // File was created
+	ActionUpdated  Action = "updated"  // File content or mode was updated
+	ActionInserted Action = "inserted" // Line was inserted
+	ActionMoved    Action = "moved"    // Existing line was moved
+	ActionReplaced Action = "replaced" // Line(s) were replaced
+	ActionRemoved  Action = "removed"  // Line(s) were removed
+	ActionRun      Action = "run"      // Command was run
+)
+
+// Result is a structured report of what a function changed. Before
+// and after hashes are hex encoded SHA-256 sums of the file content,
+// BeforeHash is empty if the file did not exist. Diff is a unified
+// diff of the change (if applicable).
+type Result struct {
+	Changed    bool
+	Action     Action
+	Path       string
+	Command    string
+	BeforeHash string
+	AfterHash  string
+	Diff       string
+}
+
+// String returns a one-line summary of the result, e.g "changed:
+// inserted /etc/hosts" or "ok: /etc/hosts".
+func (r Result) String() string {
+	target := r.Path
+	if r.Command != "" {
+		target = r.Command
+	}
+	if !r.Changed {
+		return fmt.Sprintf("ok: %s", target)
+	}
+	return fmt.Sprintf("changed: %s %s", r.Action, target)
+}
+
+// hashContent returns the hex encoded SHA-256 sum of content.
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hex encoded SHA-256 sum of the content of file
+// path. Returns error on failure.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// hashReader returns the hex encoded SHA-256 sum of everything read
+// from r. Returns error on failure.
+func hashReader(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
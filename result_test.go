@@ -0,0 +1,71 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResults(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "config")
+
+	putTests := []struct {
+		content  string
+		perm     int
+		changed  bool
+		action   Action
+		sameHash bool
+	}{
+		{"Hello = world", 0644, true, ActionCreated, false},
+		{"Hello = world", 0644, false, ActionNone, true},
+		{"Hello = world", 0600, true, ActionUpdated, true},
+		{"Hello = universe", 0600, true, ActionUpdated, false},
+	}
+	for i, tt := range putTests {
+		result, err := PutFileWithResult(textfile, tt.content, os.FileMode(tt.perm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Changed != tt.changed || result.Action != tt.action {
+			t.Errorf("PutFile %d: expected changed=%t action=%s, got %s", i, tt.changed, tt.action, result)
+		}
+		if (result.BeforeHash == result.AfterHash) != tt.sameHash {
+			t.Errorf("PutFile %d: unexpected hashes %q and %q", i, result.BeforeHash, result.AfterHash)
+		}
+	}
+
+	after := "Hello"
+	ensureTests := []struct {
+		line          string
+		before, after *string
+		changed       bool
+		action        Action
+	}{
+		{"Another = line", nil, nil, true, ActionInserted},
+		{"Another = line", nil, nil, false, ActionNone},
+		{"Another = line", nil, &after, false, ActionNone},
+		{"Third = line", nil, nil, true, ActionInserted},
+		{"Third = line", nil, &after, true, ActionMoved},
+		{"Third", nil, &after, true, ActionReplaced},
+	}
+	for i, tt := range ensureTests {
+		result, err := EnsureLineInFileWithResult(textfile, tt.line, tt.before, tt.after, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Changed != tt.changed || result.Action != tt.action {
+			t.Errorf("EnsureLineInFile %d: expected changed=%t action=%s, got %s", i, tt.changed, tt.action, result)
+		}
+		if result.Changed && result.Diff == "" {
+			t.Errorf("EnsureLineInFile %d: expected a diff", i)
+		}
+	}
+
+	result, err := RemoveLineFromFileWithResult(textfile, "Third", -1, nil, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Changed || result.Action != ActionRemoved {
+		t.Errorf("RemoveLineFromFile: expected changed=true action=%s, got %s", ActionRemoved, result)
+	}
+}
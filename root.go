@@ -0,0 +1,86 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Maximum number of symlinks followed when resolving a path under
+// Ops.Root, same as Linux MAXSYMLINKS.
+const maxSymlinks = 40
+
+// ErrEscapesRoot is returned when a path would resolve to a location
+// outside of Ops.Root.
+var ErrEscapesRoot = errors.New("path escapes root")
+
+// resolve returns p resolved under Root, similar to how p would be
+// resolved inside a chroot(2) at Root. Relative paths are relative to
+// Root. Symlinks are followed and resolved relative to Root, absolute
+// symlink targets are interpreted as starting at Root. A path (or
+// symlink) escaping Root using `..` returns ErrEscapesRoot. Path
+// components that do not exist yet are resolved lexically. If Root is
+// empty, p is returned unmodified.
+func (o *Ops) resolve(p string) (string, error) {
+	if o.Root == "" {
+		return p, nil
+	}
+	root, err := filepath.Abs(o.Root)
+	if err != nil {
+		return "", err
+	}
+
+	var resolved []string
+	remaining := splitPath(p)
+	links := 0
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+		switch component {
+		case ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", fmt.Errorf("%s: %w %s", p, ErrEscapesRoot, o.Root)
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		candidate := filepath.Join(root, filepath.Join(resolved...), component)
+		info, err := os.Lstat(candidate)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Non-existing components and non-symlinks are taken as is
+			resolved = append(resolved, component)
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", p)
+		}
+		target, err := os.Readlink(candidate)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = nil
+		}
+		remaining = append(splitPath(target), remaining...)
+	}
+
+	return filepath.Join(root, filepath.Join(resolved...)), nil
+}
+
+// splitPath splits p into its non-empty components.
+func splitPath(p string) []string {
+	var components []string
+	for _, c := range strings.Split(filepath.ToSlash(p), "/") {
+		if c != "" {
+			components = append(components, c)
+		}
+	}
+	return components
+}
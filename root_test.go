@@ -0,0 +1,58 @@
+package fileops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	root := t.TempDir()
+	o := &Ops{Root: root}
+
+	if err := o.PutFile("/etc/passwd", "root:x:0:0:root:/root:/bin/sh\nalice:x:1000:1000:Alice,,,:/home/alice:/bin/bash", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.MkdirAll("/run/resolve"); err != nil {
+		t.Fatal(err)
+	}
+	// Absolute symlink target is interpreted relative to root
+	if err := os.Symlink("/run/resolve/stub.conf", filepath.Join(root, "etc", "resolv.conf")); err != nil {
+		t.Fatal(err)
+	}
+	// Relative symlink escaping root
+	if err := os.Symlink("../../../../../../../../tmp", filepath.Join(root, "etc", "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.PutFile("/etc/resolv.conf", "nameserver 127.0.0.53", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !Exists(filepath.Join(root, "run", "resolve", "stub.conf")) {
+		t.Error("Expected file to be written through symlink under root")
+	}
+	if info, err := os.Lstat(filepath.Join(root, "etc", "resolv.conf")); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected symlink to be preserved")
+	}
+
+	for _, p := range []string{"/../etc/hosts", "/etc/escape/file", "../outside"} {
+		if err := o.PutFile(p, "should not be written", 0644); !errors.Is(err, ErrEscapesRoot) {
+			t.Errorf("Expected ErrEscapesRoot for %q, got %v", p, err)
+		}
+	}
+
+	if !o.UserExists("alice") {
+		t.Error("Expected user alice to exist under root")
+	}
+	if o.UserExists("bob") {
+		t.Error("Expected user bob not to exist under root")
+	}
+	home, err := o.HomeDir("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/home/alice"; home != expected {
+		t.Errorf("Expected home directory %q, got %q", expected, home)
+	}
+}
@@ -1,42 +1,266 @@
 package fileops
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"al.essio.dev/pkg/shellescape"
 )
 
+// Run runs command using /bin/sh -c with stdin, stdout and stderr
+// connected to os.Stdin, os.Stdout and os.Stderr. Returns error if the
+// command could not be run or exited non-zero.
 func Run(command string) error {
+	return std().Run(command)
+}
+
+// Run is Run using the settings of o. Stdin, stdout and stderr of
+// the command are connected to Ops.Stdin, Ops.Stdout and Ops.Stderr.
+func (o *Ops) Run(command string) error {
+	_, err := o.RunWithResult(command)
+	return err
+}
+
+// RunWithResult is Run returning a Result. A command that is run is
+// always considered a change. Returns error if the command could not
+// be run or exited non-zero.
+func RunWithResult(command string) (Result, error) {
+	return std().RunWithResult(command)
+}
+
+// RunWithResult is RunWithResult using the settings of o.
+func (o *Ops) RunWithResult(command string) (Result, error) {
+	return o.RunContext(context.Background(), command, RunOptions{})
+}
+
+// RunOptions configures RunContext. The zero value runs the command
+// like Run.
+type RunOptions struct {
+	// Timeout, if positive, kills the command if it has not finished
+	// within Timeout.
+	Timeout time.Duration
+	// Env are extra environment variables (key=value) added to the
+	// environment of the current process, or to an empty environment
+	// if ClearEnv is true.
+	Env      []string
+	ClearEnv bool
+	// Dir, unless empty, is the working directory of the command,
+	// resolved under Ops.Root if set.
+	Dir string
+	// User and Group, unless empty, are the name or numeric id of the
+	// user and group to run the command as (requires privileges). If
+	// Group is empty, the primary group of User is used and it is an
+	// error if User has none in the user database.
+	User, Group string
+}
+
+// RunContext runs command like RunWithResult, but configured by opts
+// (see RunOptions) and killed if ctx is done or opts.Timeout passes.
+// Unless ctx can never be done and there is no timeout, the command
+// runs in a process group of its own and the whole group is killed,
+// including processes spawned by the command. Such a command can not
+// read from the controlling terminal. Returns a Result or error if
+// the command could not be run, exited non-zero or was killed, in
+// which case the error wraps ctx.Err().
+func RunContext(ctx context.Context, command string, opts RunOptions) (Result, error) {
+	return std().RunContext(ctx, command, opts)
+}
+
+// RunContext is RunContext using the settings of o.
+func (o *Ops) RunContext(ctx context.Context, command string, opts RunOptions) (result Result, err error) {
+	defer func() { o.logResult(result, err) }()
+	result = Result{Changed: true, Action: ActionRun, Command: command}
 	shell := `/bin/sh`
 	shellCommandOption := `-c`
 
-	fmt.Fprintf(os.Stderr, "RUN %q\n", command)
+	o.report(Event{Kind: EventCommandRun, Command: command, Action: ActionRun, Message: fmt.Sprintf("RUN %q", command)})
 
-	if DryRun {
-		fmt.Fprintf(os.Stderr, "exec.Command(%q, %q, %q)\n", shell, shellCommandOption, command)
-		return nil
+	if o.DryRun {
+		o.reportCall("exec.Command(%q, %q, %q)", shell, shellCommandOption, command)
+		return result, nil
 	}
 
-	cmd := exec.Command(shell, shellCommandOption, command)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	_, err = o.runCommand(ctx, shell, []string{shellCommandOption, command}, opts, o.stdout(), o.stderr())
+	return result, o.orExit(err)
+}
 
-	err := cmd.Run()
-	if err != nil {
-		return orExit(fmt.Errorf("error running %q %q %q: %w", shell, shellCommandOption, command, err))
+// RunArgs runs name with args directly, without a shell, with stdin,
+// stdout and stderr connected to os.Stdin, os.Stdout and os.Stderr.
+// Unlike Run, arguments need no escaping. If name contains no path
+// separators, it is looked up in PATH. In dry-run mode, the command
+// line is printed shell quoted. Returns error if the command could
+// not be run or exited non-zero.
+func RunArgs(name string, args ...string) error {
+	return std().RunArgs(name, args...)
+}
+
+// RunArgs is RunArgs using the settings of o. Stdin, stdout and
+// stderr of the command are connected to Ops.Stdin, Ops.Stdout and
+// Ops.Stderr.
+func (o *Ops) RunArgs(name string, args ...string) error {
+	_, err := o.RunArgsWithResult(name, args...)
+	return err
+}
+
+// RunArgsWithResult is RunArgs returning a Result with the shell
+// quoted command line as Command. Returns error if the command could
+// not be run or exited non-zero.
+func RunArgsWithResult(name string, args ...string) (Result, error) {
+	return std().RunArgsWithResult(name, args...)
+}
+
+// RunArgsWithResult is RunArgsWithResult using the settings of o.
+func (o *Ops) RunArgsWithResult(name string, args ...string) (Result, error) {
+	return o.RunArgsContext(context.Background(), RunOptions{}, name, args...)
+}
+
+// RunArgsContext is RunArgsWithResult configured by opts and killed
+// if ctx is done, see RunContext.
+func RunArgsContext(ctx context.Context, opts RunOptions, name string, args ...string) (Result, error) {
+	return std().RunArgsContext(ctx, opts, name, args...)
+}
+
+// RunArgsContext is RunArgsContext using the settings of o.
+func (o *Ops) RunArgsContext(ctx context.Context, opts RunOptions, name string, args ...string) (result Result, err error) {
+	defer func() { o.logResult(result, err) }()
+	command := shellescape.QuoteCommand(append([]string{name}, args...))
+	result = Result{Changed: true, Action: ActionRun, Command: command}
+
+	o.report(Event{Kind: EventCommandRun, Command: command, Action: ActionRun, Message: "RUN " + command})
+
+	if o.DryRun {
+		o.reportCall("exec.Command(%s)", quoteArgs(append([]string{name}, args...), ", "))
+		return result, nil
+	}
+
+	_, err = o.runCommand(ctx, name, args, opts, o.stdout(), o.stderr())
+	return result, o.orExit(err)
+}
+
+// runCommand runs name with args configured by opts, writing its
+// standard output and error to stdout and stderr. Returns the exit
+// code of the command (-1 if it did not exit normally) and error if
+// it could not be run, exited non-zero or was killed, in which case
+// the error wraps ctx.Err().
+func (o *Ops) runCommand(ctx context.Context, name string, args []string, opts RunOptions, stdout, stderr io.Writer) (int, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = o.stdin()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := o.configureCommand(ctx, cmd, opts); err != nil {
+		return -1, err
+	}
+
+	if err := cmd.Run(); err != nil {
+		exitCode := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		err = fmt.Errorf("error running %s: %w", quoteArgs(append([]string{name}, args...), " "), err)
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		return exitCode, err
 	}
 
 	// Attempt to resolve possible race condition by syncing before
 	// exiting.
 	syscall.Sync()
 
+	return 0, nil
+}
+
+// configureCommand applies the environment, working directory and
+// credentials of opts to cmd and makes cancelling ctx kill the
+// process group of cmd unless ctx can never be done.
+func (o *Ops) configureCommand(ctx context.Context, cmd *exec.Cmd, opts RunOptions) error {
+	if opts.ClearEnv || len(opts.Env) > 0 {
+		env := []string{}
+		if !opts.ClearEnv {
+			env = os.Environ()
+		}
+		cmd.Env = append(env, opts.Env...)
+	}
+	if opts.Dir != "" {
+		dir, err := o.resolve(opts.Dir)
+		if err != nil {
+			return err
+		}
+		cmd.Dir = dir
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if opts.User != "" || opts.Group != "" {
+		credential, err := o.credential(opts.User, opts.Group)
+		if err != nil {
+			return err
+		}
+		cmd.SysProcAttr.Credential = credential
+	}
+	if ctx.Done() != nil {
+		cmd.SysProcAttr.Setpgid = true
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		cmd.WaitDelay = killWaitDelay
+	}
 	return nil
 }
 
+// quoteArgs returns args quoted with %q and separated by sep.
+func quoteArgs(args []string, sep string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = strconv.Quote(arg)
+	}
+	return strings.Join(quoted, sep)
+}
+
+// killWaitDelay is how long to wait for the output of a killed
+// command to be closed before giving up on it.
+const killWaitDelay = 5 * time.Second
+
+// credential returns the credential of userName and group (names or
+// numeric ids). If group is empty, the primary group of userName is
+// used. If userName is empty, the current user is used. Returns error
+// if the primary group of userName can not be found.
+func (o *Ops) credential(userName, group string) (*syscall.Credential, error) {
+	uid, gid, err := o.lookupIDs(userName, group)
+	if err != nil {
+		return nil, err
+	}
+	if uid == -1 {
+		uid = os.Getuid()
+	}
+	if gid == -1 && userName == "" {
+		gid = os.Getgid()
+	} else if gid == -1 {
+		lookup := o.lookupUser
+		if _, err := strconv.Atoi(userName); err == nil {
+			lookup = o.lookupUserID
+		}
+		u, err := lookup(userName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up primary group of user %s: %w", userName, err)
+		}
+		if gid, err = strconv.Atoi(u.Gid); err != nil {
+			return nil, fmt.Errorf("invalid gid of user %s: %w", userName, err)
+		}
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
 // Escape is an alias for shellescape.Quote(s) used to escape a
 // variable for use in shell command. Returns s escaped.
 func Escape(s string) string {
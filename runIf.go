@@ -0,0 +1,122 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// RunIfOptions configures RunIf. Every guard that is set must allow
+// the command to run, similar to the creates, removes, onlyif and
+// unless parameters of Puppet exec or Ansible command.
+type RunIfOptions struct {
+	RunOptions
+	// Creates, unless empty, skips the command if path Creates
+	// exists.
+	Creates string
+	// Removes, unless empty, skips the command if path Removes does
+	// not exist.
+	Removes string
+	// OnlyIf, unless empty, is a probe command (run using /bin/sh -c
+	// like the command) and the command only runs if the probe exits
+	// zero.
+	OnlyIf string
+	// Unless, unless empty, is a probe command and the command only
+	// runs if the probe exits non-zero.
+	Unless string
+	// DryRunProbes runs the probes in dry-run mode as well. Probes are
+	// then expected not to change anything. Otherwise probes are only
+	// printed in dry-run mode and assumed to allow the command.
+	DryRunProbes bool
+}
+
+// RunIf runs command like RunContext unless skipped by one of the
+// guards of opts, see RunIfOptions. Probes run with the environment,
+// working directory and user of opts.RunOptions and their output is
+// discarded. Returns a Result which is unchanged if the command was
+// skipped, or error if a probe could not be run or the command failed.
+func RunIf(command string, opts RunIfOptions) (Result, error) {
+	return std().RunIf(command, opts)
+}
+
+// RunIf is RunIf using the settings of o.
+func (o *Ops) RunIf(command string, opts RunIfOptions) (Result, error) {
+	return o.RunIfContext(context.Background(), command, opts)
+}
+
+// RunIfContext is RunIf killing probes and command if ctx is done,
+// see RunContext.
+func RunIfContext(ctx context.Context, command string, opts RunIfOptions) (Result, error) {
+	return std().RunIfContext(ctx, command, opts)
+}
+
+// RunIfContext is RunIfContext using the settings of o.
+func (o *Ops) RunIfContext(ctx context.Context, command string, opts RunIfOptions) (result Result, err error) {
+	reason, err := o.skipReason(ctx, opts)
+	if err != nil {
+		result = Result{Action: ActionNone, Command: command}
+		o.logResult(result, err)
+		return result, o.orExit(err)
+	}
+	if reason != "" {
+		result = Result{Action: ActionNone, Command: command}
+		o.report(Event{Kind: EventSkipped, Command: command, Message: fmt.Sprintf("RunIf: %q skipped, %s.", command, reason)})
+		o.logResult(result, nil)
+		return result, nil
+	}
+	return o.RunContext(ctx, command, opts.RunOptions)
+}
+
+// skipReason evaluates the guards of opts. Returns why the command
+// should be skipped or an empty string if it should run, error if a
+// probe could not be run.
+func (o *Ops) skipReason(ctx context.Context, opts RunIfOptions) (string, error) {
+	if opts.Creates != "" && o.Exists(opts.Creates) {
+		return fmt.Sprintf("%s exists", opts.Creates), nil
+	}
+	if opts.Removes != "" && !o.Exists(opts.Removes) {
+		return fmt.Sprintf("%s does not exist", opts.Removes), nil
+	}
+	probes := []struct {
+		command string
+		runIf   bool
+		reason  string
+	}{
+		{opts.OnlyIf, true, "onlyif probe %q failed"},
+		{opts.Unless, false, "unless probe %q succeeded"},
+	}
+	for _, probe := range probes {
+		if probe.command == "" {
+			continue
+		}
+		if o.DryRun && !opts.DryRunProbes {
+			o.reportCall("exec.Command(%q, %q, %q)", "/bin/sh", "-c", probe.command)
+			continue
+		}
+		succeeded, err := o.probe(ctx, probe.command, opts.RunOptions)
+		if err != nil {
+			return "", err
+		}
+		if succeeded != probe.runIf {
+			return fmt.Sprintf(probe.reason, probe.command), nil
+		}
+	}
+	return "", nil
+}
+
+// probe runs command with its output discarded. Returns true if it
+// exited zero, false if non-zero, error if it could not be run or was
+// killed.
+func (o *Ops) probe(ctx context.Context, command string, opts RunOptions) (bool, error) {
+	exitCode, err := o.runCommand(ctx, "/bin/sh", []string{"-c", command}, opts, io.Discard, io.Discard)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case exitCode > 0 && errors.As(err, &exitErr) && ctx.Err() == nil:
+		return false, nil
+	}
+	return false, err
+}
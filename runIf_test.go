@@ -0,0 +1,55 @@
+package fileops
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunIf(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "installed")
+	var stderr bytes.Buffer
+	o := &Ops{Stderr: &stderr}
+	install := "touch " + Escape(marker)
+
+	tests := []struct {
+		name    string
+		opts    RunIfOptions
+		changed bool
+	}{
+		{"removes", RunIfOptions{Removes: marker}, false},
+		{"onlyif", RunIfOptions{OnlyIf: "false"}, false},
+		{"unless", RunIfOptions{Unless: "true"}, false},
+		{"creates", RunIfOptions{Creates: marker, OnlyIf: "true", Unless: "false"}, true},
+		{"created", RunIfOptions{Creates: marker}, false},
+	}
+	for _, tt := range tests {
+		result, err := o.RunIf(install, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Changed != tt.changed {
+			t.Errorf("%s: expected changed=%t, got %s", tt.name, tt.changed, result)
+		}
+	}
+	if !strings.Contains(stderr.String(), "skipped, "+marker+" exists.") {
+		t.Errorf("Expected skip to be reported, got %q", stderr.String())
+	}
+
+	os.Remove(marker)
+	stderr.Reset()
+	dry := &Ops{DryRun: true, Stderr: &stderr}
+	result, err := dry.RunIf(install, RunIfOptions{Unless: "touch " + Escape(marker)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Changed || Exists(marker) {
+		t.Errorf("Expected probe not to run in dry-run, got %s", result)
+	}
+	if result, err = dry.RunIf(install, RunIfOptions{OnlyIf: "false", DryRunProbes: true}); err != nil || result.Changed {
+		t.Errorf("Expected probe to skip command in dry-run, got %s, %v", result, err)
+	}
+}
@@ -0,0 +1,99 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunContext(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	o := &Ops{Root: root, Stdout: &stdout, Reporter: SilentReporter{}}
+	if _, err := o.RunContext(context.Background(), `echo "$FOO-$HOME"; pwd`, RunOptions{Env: []string{"FOO=bar"}, ClearEnv: true, Dir: "/sub"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "bar-\n" + filepath.Join(root, "sub") + "\n"; stdout.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, stdout.String())
+	}
+
+	start := time.Now()
+	_, err := o.RunContext(context.Background(), "sleep 30 & sleep 30", RunOptions{Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected process group to be killed promptly, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := o.RunContext(ctx, "true", RunOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled, got %v", err)
+	}
+	if _, err := (&Ops{Reporter: SilentReporter{}}).RunContext(context.Background(), "true", RunOptions{User: "nobody-such-user"}); err == nil || !strings.Contains(err.Error(), "nobody-such-user") {
+		t.Errorf("Expected unknown user error, got %v", err)
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	o := &Ops{Stdout: &stdout, Stderr: &stderr}
+	if err := o.RunArgs("printf", "%s|", "it's", "$HOME", "a b"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "it's|$HOME|a b|"; stdout.String() != expected {
+		t.Errorf("Expected arguments passed verbatim %q, got %q", expected, stdout.String())
+	}
+	if expected := `RUN printf '%s|' 'it'"'"'s' '$HOME' 'a b'` + "\n"; stderr.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stderr.String())
+	}
+
+	stderr.Reset()
+	dry := &Ops{DryRun: true, Stderr: &stderr}
+	result, err := dry.RunArgsWithResult("rm", "-rf", "/tmp/x y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Command != `rm -rf '/tmp/x y'` {
+		t.Errorf("Unexpected command %q", result.Command)
+	}
+	if expected := "RUN rm -rf '/tmp/x y'\nexec.Command(\"rm\", \"-rf\", \"/tmp/x y\")\n"; stderr.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stderr.String())
+	}
+	if err := o.RunArgs("false"); err == nil || err.Error() != `error running "false": exit status 1` {
+		t.Errorf("Expected error, got %v", err)
+	}
+}
+
+func TestRunAsNumericUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Changing user requires root")
+	}
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("app:x:1234:2345::/nonexistent:/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	o := &Ops{Root: root, Stdout: &stdout, Reporter: SilentReporter{}}
+	if _, err := o.RunContext(context.Background(), "id -u; id -g", RunOptions{User: "1234"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "1234\n2345\n"; stdout.String() != expected {
+		t.Errorf("Expected primary group of numeric user %q, got %q", expected, stdout.String())
+	}
+	if _, err := o.RunContext(context.Background(), "true", RunOptions{User: "4321"}); err == nil || !strings.Contains(err.Error(), "4321") {
+		t.Errorf("Expected error for numeric user without primary group, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package fileops
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// TemplateSuffix is the file name suffix of templates in
+// PutTemplateFromFS when TemplateOptions.SuffixOnly is set.
+const TemplateSuffix = ".tmpl"
+
+// TemplateFuncs returns the functions available in templates rendered
+// by PutTemplate and PutTemplateFromFS in addition to the text/template
+// builtins: escape (Escape, for shell quoting), join, split, lower,
+// upper, trim, trimPrefix, trimSuffix, replace, contains, hasPrefix
+// and hasSuffix.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"escape":     Escape,
+		"join":       func(sep string, elems []string) string { return strings.Join(elems, sep) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	}
+}
+
+// TemplateOptions configures PutTemplate and PutTemplateFromFS. The
+// embedded FileOptions apply to every file written.
+type TemplateOptions struct {
+	FileOptions
+	// Funcs are added to (or override) TemplateFuncs.
+	Funcs template.FuncMap
+	// SuffixOnly makes PutTemplateFromFS render only files named with
+	// TemplateSuffix, which is stripped from the destination file
+	// name. Other files are copied verbatim.
+	SuffixOnly bool
+}
+
+// PutTemplate renders Go text/template tmpl with data (see
+// TemplateFuncs for available functions) and writes the result into
+// local file destination like PutFileWithOptions. In dry-run mode,
+// the diff between the existing and the rendered content is printed.
+// Returns a Result describing the change or error if parsing,
+// rendering or writing failed.
+func PutTemplate(destination, tmpl string, data any, opts TemplateOptions) (Result, error) {
+	return std().PutTemplate(destination, tmpl, data, opts)
+}
+
+// PutTemplate is PutTemplate using the settings of o.
+func (o *Ops) PutTemplate(destination, tmpl string, data any, opts TemplateOptions) (Result, error) {
+	o.reportCall("PutTemplate(%q, <template>, <data>, %+v)", destination, opts.FileOptions)
+	result, err := o.putTemplate(destination, path.Base(destination), tmpl, data, opts)
+	return result, o.orExit(err)
+}
+
+// PutTemplateFromFS renders a template file or recursively every
+// template in a directory from an fs.FS interface with data and
+// writes the results to a target path on the local filesystem like
+// PutFileFromFSWithOptions. If opts.SuffixOnly is set, only files
+// named with TemplateSuffix are rendered (and written without the
+// suffix), other files are copied verbatim. Returns one Result per
+// file written, results so far and error in case of failure.
+func PutTemplateFromFS(fsys fs.FS, source, destination string, data any, opts TemplateOptions) ([]Result, error) {
+	return std().PutTemplateFromFS(fsys, source, destination, data, opts)
+}
+
+// PutTemplateFromFS is PutTemplateFromFS using the settings of o.
+func (o *Ops) PutTemplateFromFS(fsys fs.FS, source, destination string, data any, opts TemplateOptions) ([]Result, error) {
+	o.reportCall("PutTemplateFromFS(<fs>, %q, %q, <data>, %+v)", source, destination, opts.FileOptions)
+	put := func(srcFile, destFile string) (Result, error) {
+		if opts.SuffixOnly && !strings.HasSuffix(srcFile, TemplateSuffix) {
+			return o.copyFile(fsys, srcFile, destFile, opts.FileOptions)
+		}
+		tmpl, err := fs.ReadFile(fsys, srcFile)
+		if err != nil {
+			return Result{Action: ActionNone, Path: destFile}, fmt.Errorf("failed to read template: %w", err)
+		}
+		if opts.SuffixOnly {
+			destFile = strings.TrimSuffix(destFile, TemplateSuffix)
+		}
+		return o.putTemplate(destFile, srcFile, string(tmpl), data, opts)
+	}
+
+	srcInfo, err := fs.Stat(fsys, source)
+	if err != nil {
+		return nil, o.orExit(fmt.Errorf("failed to stat source path: %w", err))
+	}
+	if srcInfo.IsDir() {
+		results, err := o.copyDir(fsys, source, destination, opts.FileOptions, put)
+		return results, o.orExit(err)
+	}
+	result, err := put(source, destination)
+	return []Result{result}, o.orExit(err)
+}
+
+// putTemplate renders tmpl named name with data and writes it to
+// destination.
+func (o *Ops) putTemplate(destination, name, tmpl string, data any, opts TemplateOptions) (Result, error) {
+	content, err := renderTemplate(name, tmpl, data, opts.Funcs)
+	if err != nil {
+		return Result{Action: ActionNone, Path: destination}, err
+	}
+	return o.putFile(destination, content, opts.FileOptions)
+}
+
+// renderTemplate parses tmpl named name with TemplateFuncs and funcs
+// and executes it with data. Returns the rendered content or error on
+// failure.
+func renderTemplate(name, tmpl string, data any, funcs template.FuncMap) (string, error) {
+	fm := TemplateFuncs()
+	maps.Copy(fm, funcs)
+	t, err := template.New(name).Funcs(fm).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return b.String(), nil
+}
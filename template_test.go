@@ -0,0 +1,73 @@
+package fileops
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPutTemplateFromFS(t *testing.T) {
+	o := &Ops{}
+	dir := t.TempDir()
+	fsys := fstest.MapFS{
+		"etc/app/app.conf.tmpl":  {Data: []byte("name = {{ .Name | upper }}\ncmd = {{ escape .Cmd }}\n")},
+		"etc/app/static.txt":     {Data: []byte("{{ not rendered }}\n")},
+		"etc/app/sub/motd.tmpl":  {Data: []byte("Welcome to {{ .Name }}")},
+		"etc/app/sub/plain.tmpl": {Data: []byte("{{ .Missing }")},
+	}
+	data := struct{ Name, Cmd string }{"app", "echo it's"}
+
+	if _, err := o.PutTemplateFromFS(fsys, "etc/app", dir, data, TemplateOptions{SuffixOnly: true}); err == nil {
+		t.Fatal("Expected parse error")
+	}
+	delete(fsys, "etc/app/sub/plain.tmpl")
+	results, err := o.PutTemplateFromFS(fsys, "etc/app", dir, data, TemplateOptions{SuffixOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Expected 3 results, got %v", results)
+	}
+	for name, expected := range map[string]string{
+		"app.conf":   "name = APP\ncmd = 'echo it'\"'\"'s'\n",
+		"static.txt": "{{ not rendered }}\n",
+		"sub/motd":   "Welcome to app\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("Expected %s content %q, got %q", name, expected, content)
+		}
+	}
+}
+
+func TestPutTemplateDryRun(t *testing.T) {
+	textfile := filepath.Join(t.TempDir(), "motd")
+	if err := os.WriteFile(textfile, []byte("Welcome\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	o := &Ops{DryRun: true, Stderr: &stderr}
+	result, err := o.PutTemplate(textfile, "Welcome to {{ .host }}", map[string]string{"host": "gw"}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionUpdated {
+		t.Errorf("Expected update, got %s", result)
+	}
+	if !strings.Contains(stderr.String(), "-Welcome\n+Welcome to gw\n") {
+		t.Errorf("Expected rendered diff in dry-run output, got %q", stderr.String())
+	}
+	content, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Welcome\n" {
+		t.Errorf("Expected file to be untouched, got %q", content)
+	}
+}
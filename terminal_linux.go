@@ -0,0 +1,19 @@
+//go:build linux
+
+package fileops
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth returns the width of terminal f in columns, $COLUMNS
+// or -1 if it can not be determined.
+func terminalWidth(f *os.File) int {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); errno == 0 && ws.Col > 0 {
+		return int(ws.Col)
+	}
+	return columns()
+}
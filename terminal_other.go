@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fileops
+
+import "os"
+
+// terminalWidth returns $COLUMNS or -1 if not set.
+func terminalWidth(f *os.File) int {
+	return columns()
+}
@@ -0,0 +1,182 @@
+package fileops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+)
+
+// Transaction stages a number of steps, e.g PutFile, EnsureLineInFile
+// and Run, that are applied together by Apply. Before a step modifies
+// a file or directory for the first time, its content, mode and
+// ownership (or the fact that it did not exist) is recorded. If any
+// step fails, e.g a command validating the new configuration, every
+// touched file and directory is rolled back to its original state.
+// Commands already run are not undone and backups made are kept. A
+// Transaction is not safe for concurrent use.
+type Transaction struct {
+	ops       *Ops
+	steps     []func(o *Ops) error
+	snapshots []snapshot
+	seen      map[string]bool
+	applied   bool
+}
+
+// snapshot is the original state of a path touched in a Transaction.
+type snapshot struct {
+	path     string
+	existed  bool
+	mode     os.FileMode
+	uid, gid int
+	content  []byte
+}
+
+// NewTransaction returns a new Transaction applied using the
+// package wide settings, see Ops.NewTransaction.
+func NewTransaction() *Transaction {
+	return std().NewTransaction()
+}
+
+// NewTransaction returns a new Transaction applied using the settings
+// of o.
+func (o *Ops) NewTransaction() *Transaction {
+	return &Transaction{ops: o, seen: make(map[string]bool)}
+}
+
+// Add stages step. Apply calls step with an Ops configured like the
+// one the Transaction was created from, every method of that Ops
+// (e.g o.PutFile or o.EnsureLineInFile) participates in the
+// Transaction. Returns t for chaining.
+func (t *Transaction) Add(step func(o *Ops) error) *Transaction {
+	t.steps = append(t.steps, step)
+	return t
+}
+
+// Run stages running command, see Ops.Run. A failing command, e.g
+// one validating files written by earlier steps, rolls the
+// Transaction back. Returns t for chaining.
+func (t *Transaction) Run(command string) *Transaction {
+	return t.Add(func(o *Ops) error { return o.Run(command) })
+}
+
+// Apply runs all staged steps in order. If a step fails, every file
+// and directory touched by the steps is restored to its original
+// state (in dry-run mode nothing needs to be restored) and the error
+// of the step is returned, joined with any error rolling back. A
+// Transaction can only be applied once.
+func (t *Transaction) Apply() error {
+	if t.applied {
+		return t.ops.orExit(errors.New("transaction already applied"))
+	}
+	t.applied = true
+	// Errors must be returned to roll back before exiting
+	o := *t.ops
+	o.ExitOnError = false
+	o.tx = t
+	for i, step := range t.steps {
+		if err := step(&o); err != nil {
+			err = fmt.Errorf("transaction step %d: %w", i+1, err)
+			if rollbackErr := t.rollback(); rollbackErr != nil {
+				err = errors.Join(err, fmt.Errorf("rollback failed: %w", rollbackErr))
+			}
+			return t.ops.orExit(err)
+		}
+	}
+	return nil
+}
+
+// touch records the original state of path, unless already recorded,
+// if o is part of a Transaction. Must be called before path is
+// modified. Returns error if the state could not be recorded.
+func (o *Ops) touch(path string) error {
+	if o.tx == nil || o.DryRun {
+		return nil
+	}
+	if err := o.tx.record(path); err != nil {
+		return fmt.Errorf("failed to record state of %s: %w", path, err)
+	}
+	return nil
+}
+
+// record records the original state of path and, if path is a
+// symlink, the file it points to.
+func (t *Transaction) record(path string) error {
+	if t.seen[path] {
+		return nil
+	}
+	s := snapshot{path: path}
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		s.existed = true
+		s.mode = info.Mode()
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			s.uid, s.gid = int(st.Uid), int(st.Gid)
+		}
+		if info.Mode().IsRegular() {
+			if s.content, err = os.ReadFile(path); err != nil {
+				return err
+			}
+		}
+	}
+	t.seen[path] = true
+	t.snapshots = append(t.snapshots, s)
+	if s.mode&os.ModeSymlink != 0 {
+		if target, err := filepath.EvalSymlinks(path); err == nil {
+			return t.record(target)
+		}
+	}
+	return nil
+}
+
+// rollback restores the recorded paths in reverse order.
+func (t *Transaction) rollback() error {
+	var errs []error
+	for _, s := range slices.Backward(t.snapshots) {
+		if err := s.restore(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restore restores the original state of s.path.
+func (s snapshot) restore() error {
+	info, err := os.Lstat(s.path)
+	switch {
+	case !s.existed && os.IsNotExist(err):
+		return nil
+	case !s.existed:
+		return os.Remove(s.path)
+	case err != nil:
+		return err
+	}
+	if s.mode.IsRegular() {
+		current, err := os.ReadFile(s.path)
+		if err != nil || !bytes.Equal(current, s.content) {
+			if err := replaceFileAtomic(s.path, bytes.NewReader(s.content), modeBits(s.mode), true, nil); err != nil {
+				return err
+			}
+			if info, err = os.Lstat(s.path); err != nil {
+				return err
+			}
+		}
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && (int(st.Uid) != s.uid || int(st.Gid) != s.gid) {
+		if err := os.Lchown(s.path, s.uid, s.gid); err != nil {
+			return err
+		}
+	}
+	// Chmod after chown as chown may clear setuid/setgid bits.
+	if s.mode&os.ModeSymlink == 0 && modeBits(info.Mode()) != modeBits(s.mode) {
+		return os.Chmod(s.path, modeBits(s.mode))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	root := t.TempDir()
+	o := &Ops{Root: root, Reporter: SilentReporter{}}
+	if err := o.PutFile("/etc/app.conf", "port = 80", 0640); err != nil {
+		t.Fatal(err)
+	}
+	stage := func(tx *Transaction, validate string) *Transaction {
+		return tx.Add(func(o *Ops) error {
+			return o.PutFile("/etc/app.conf", "port = 8080", 0600)
+		}).Add(func(o *Ops) error {
+			return o.EnsureLineInFile("/etc/app.conf", "debug = true", nil, nil, true, false)
+		}).Add(func(o *Ops) error {
+			return o.PutFile("/etc/app.d/extra.conf", "log = on", 0644)
+		}).Run(validate)
+	}
+
+	if err := stage(o.NewTransaction(), "false").Apply(); err == nil || err.Error() != `transaction step 4: error running "/bin/sh" "-c" "false": exit status 1` {
+		t.Fatalf("Expected failing validation to fail the transaction, got %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(root, "etc", "app.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "port = 80\n" {
+		t.Errorf("Expected original content after rollback, got %q", content)
+	}
+	info, err := os.Stat(filepath.Join(root, "etc", "app.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected original mode 0640 after rollback, got %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc", "app.d")); !os.IsNotExist(err) {
+		t.Errorf("Expected created directory to be removed by rollback, got %v", err)
+	}
+
+	tx := stage(o.NewTransaction(), "true")
+	if err := tx.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if content, err = os.ReadFile(filepath.Join(root, "etc", "app.conf")); err != nil || string(content) != "port = 8080\ndebug = true\n" {
+		t.Errorf("Expected applied transaction to be kept, got %q, %v", content, err)
+	}
+	if err := tx.Apply(); err == nil {
+		t.Error("Expected error applying a transaction twice")
+	}
+}
+
+func TestTransactionSpecialBits(t *testing.T) {
+	root := t.TempDir()
+	o := &Ops{Root: root, Reporter: SilentReporter{}}
+	special := os.FileMode(0755) | os.ModeSetuid | os.ModeSetgid
+	for _, name := range []string{"changed", "chmodded"} {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte("original\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, special); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := o.NewTransaction().Add(func(o *Ops) error {
+		return o.PutFile("/changed", "modified", 0644)
+	}).Add(func(o *Ops) error {
+		return o.PutFile("/chmodded", "original", 0644)
+	}).Run("false").Apply()
+	if err == nil {
+		t.Fatal("Expected failing validation to fail the transaction")
+	}
+	for _, name := range []string{"changed", "chmodded"} {
+		info, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := special, modeBits(info.Mode()); expected != got {
+			t.Errorf("Expected mode %v of %s after rollback, got %v", expected, name, got)
+		}
+	}
+}
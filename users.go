@@ -0,0 +1,144 @@
+package fileops
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// lookupUser looks up username in the user database. If Root is set,
+// /etc/passwd under Root is consulted instead of the host's user
+// database. Returns user.UnknownUserError if the user does not exist.
+func (o *Ops) lookupUser(username string) (*user.User, error) {
+	if o.Root == "" {
+		return user.Lookup(username)
+	}
+	passwd, err := o.resolve("/etc/passwd")
+	if err != nil {
+		return nil, err
+	}
+	// name:password:UID:GID:GECOS:directory:shell
+	fields, err := findDatabaseEntry(passwd, username, 0, 7)
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, user.UnknownUserError(username)
+	}
+	return passwdUser(fields), nil
+}
+
+// lookupUserID is lookupUser looking up the user by uid. Returns
+// user.UnknownUserIdError if the user does not exist.
+func (o *Ops) lookupUserID(uid string) (*user.User, error) {
+	if o.Root == "" {
+		return user.LookupId(uid)
+	}
+	passwd, err := o.resolve("/etc/passwd")
+	if err != nil {
+		return nil, err
+	}
+	fields, err := findDatabaseEntry(passwd, uid, 2, 7)
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		id, _ := strconv.Atoi(uid)
+		return nil, user.UnknownUserIdError(id)
+	}
+	return passwdUser(fields), nil
+}
+
+// passwdUser returns the user of the fields of a passwd(5) entry.
+func passwdUser(fields []string) *user.User {
+	return &user.User{
+		Username: fields[0],
+		Uid:      fields[2],
+		Gid:      fields[3],
+		Name:     strings.Split(fields[4], ",")[0],
+		HomeDir:  fields[5],
+	}
+}
+
+// lookupGroup looks up groupname in the group database. If Root is
+// set, /etc/group under Root is consulted instead of the host's group
+// database. Returns user.UnknownGroupError if the group does not
+// exist.
+func (o *Ops) lookupGroup(groupname string) (*user.Group, error) {
+	if o.Root == "" {
+		return user.LookupGroup(groupname)
+	}
+	group, err := o.resolve("/etc/group")
+	if err != nil {
+		return nil, err
+	}
+	// group_name:password:GID:user_list
+	fields, err := findDatabaseEntry(group, groupname, 0, 3)
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, user.UnknownGroupError(groupname)
+	}
+	return &user.Group{Name: fields[0], Gid: fields[2]}, nil
+}
+
+// lookupIDs resolves owner and group, given as names or numeric ids,
+// into a uid and gid. An empty owner or group resolves to -1. Returns
+// error if a name can not be resolved.
+func (o *Ops) lookupIDs(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			usr, err := o.lookupUser(owner)
+			if err != nil {
+				return -1, -1, err
+			}
+			if uid, err = strconv.Atoi(usr.Uid); err != nil {
+				return -1, -1, fmt.Errorf("invalid uid %q of user %s", usr.Uid, owner)
+			}
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			grp, err := o.lookupGroup(group)
+			if err != nil {
+				return -1, -1, err
+			}
+			if gid, err = strconv.Atoi(grp.Gid); err != nil {
+				return -1, -1, fmt.Errorf("invalid gid %q of group %s", grp.Gid, group)
+			}
+		}
+	}
+	return uid, gid, nil
+}
+
+// findDatabaseEntry returns the colon separated fields of the first
+// entry whose field number field (0 is the name) is key in a
+// passwd(5) or group(5) style file. Entries with less than minFields
+// fields are ignored. Returns nil fields if key was not found.
+func findDatabaseEntry(database, key string, field, minFields int) ([]string, error) {
+	f, err := os.Open(database)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) >= minFields && fields[field] == key {
+			return fields, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", database, err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,39 @@
+package fileops
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrValidation is returned (wrapped) when validating a file before
+// writing it fails, see FileOptions.Validate.
+var ErrValidation = errors.New("validation failed")
+
+// newValidator returns a function validating a file by running
+// command, with %s replaced by the quoted path of the file, and
+// calling fn unless command is empty or fn is nil respectively.
+// Returns nil if there is nothing to validate.
+func newValidator(command string, fn func(path string) error) func(path string) error {
+	if command == "" && fn == nil {
+		return nil
+	}
+	return func(path string) error {
+		if command != "" {
+			if !strings.Contains(command, "%s") {
+				return fmt.Errorf("%w: validate command %q must contain %%s", ErrValidation, command)
+			}
+			c := strings.ReplaceAll(command, "%s", Escape(path))
+			if output, err := exec.Command("/bin/sh", "-c", c).CombinedOutput(); err != nil {
+				return fmt.Errorf("%w: %q: %w: %s", ErrValidation, c, err, strings.TrimSpace(string(output)))
+			}
+		}
+		if fn != nil {
+			if err := fn(path); err != nil {
+				return fmt.Errorf("%w: %w", ErrValidation, err)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package fileops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	o := &Ops{}
+	dir := t.TempDir()
+	textfile := filepath.Join(dir, "sudoers")
+	if err := os.WriteFile(textfile, []byte("ok = 1\n"), 0440); err != nil {
+		t.Fatal(err)
+	}
+	validate := "grep -q '^ok' %s || { echo 'syntax error' >&2; exit 1; }"
+
+	_, err := o.PutFileWithOptions(textfile, "broken", FileOptions{FileMode: 0440, Validate: validate})
+	if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("Expected validation error with command output, got %v", err)
+	}
+	rejected := errors.New("rejected")
+	_, err = o.EnsureLineInFileWithOptions(textfile, "ok = 2", LineOptions{Existing: "ok", ValidateFunc: func(path string) error {
+		if content, err := os.ReadFile(path); err != nil || string(content) != "ok = 2\n" {
+			t.Errorf("Expected candidate content, got %q, %v", content, err)
+		}
+		return rejected
+	}})
+	if !errors.Is(err, rejected) {
+		t.Errorf("Expected error from ValidateFunc, got %v", err)
+	}
+	if _, err := o.PutFileWithOptions(textfile, "ok = 3", FileOptions{FileMode: 0440, Validate: "true"}); err == nil {
+		t.Error("Expected error for validate command without placeholder")
+	}
+
+	content, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "ok = 1\n" {
+		t.Errorf("Expected file untouched after failed validation, got %q", content)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %v, %v", entries, err)
+	}
+
+	if _, err := o.PutFileWithOptions(textfile, "ok = 4", FileOptions{FileMode: 0440, Validate: validate}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err = os.ReadFile(textfile); err != nil || string(content) != "ok = 4\n" {
+		t.Errorf("Expected validated content to be written, got %q, %v", content, err)
+	}
+}